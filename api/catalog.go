@@ -0,0 +1,41 @@
+package api
+
+import (
+    "encoding/json"
+)
+
+// A pricing hint displayed to customers. Billing is determined by GetSubscriptionUsage.
+type PricingHint struct {
+    // Line item description, e.g. "Storage"
+    Description string `json:"description"`
+    // Label for a billable unit of volume, e.g. "GB-months". Empty for flat rates.
+    Unit string `json:"unit"`
+    // Price per unit, or flat rate per billing period.
+    Price CurrencyValue `json:"price"`
+}
+
+// A SKU offered by this vendor.
+type CatalogSku struct {
+    // SKU identifier, as used in subscription and resource requests.
+    Sku int64 `json:"sku"`
+    // Display name
+    Name string `json:"name"`
+    // Human readable description.
+    Description RichText `json:"description"`
+    // Kinds of resource which may be created in a subscription to this SKU.
+    ResourceKinds []string `json:"resourceKinds"`
+    // Optional JSON Schema for CreateResourceRequest.Configuration.
+    ConfigurationSchema json.RawMessage `json:"configurationSchema,omitempty"`
+    // Units reported in SubscriptionUsage for this SKU, e.g. "hours", "users".
+    UsageUnits []string `json:"usageUnits"`
+    // Pricing hints
+    Pricing []PricingHint `json:"pricing"`
+}
+
+type GetCatalogRequest struct {
+}
+
+type GetCatalogResponse struct {
+    // SKUs offered by this vendor, ordered by SKU.
+    Skus []CatalogSku `json:"skus"`
+}
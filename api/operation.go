@@ -0,0 +1,48 @@
+package api
+
+const (
+    // Queued, waiting for a worker.
+    OperationStatePending = "PENDING"
+    // Running, possibly after one or more failed attempts.
+    OperationStateRunning = "RUNNING"
+    // Completed successfully. Result is set.
+    OperationStateSucceeded = "SUCCEEDED"
+    // Failed after exhausting all attempts. Error is set.
+    OperationStateFailed = "FAILED"
+)
+
+// A long-running provisioning operation, executed in the background.
+type Operation struct {
+    // Unique ID for this operation
+    OperationId string `json:"operationId"`
+    // RPC method which started the operation, e.g. "CreateResource"
+    Method string `json:"method"`
+    // Operation state. Valid values: 'PENDING', 'RUNNING', 'SUCCEEDED', 'FAILED'
+    State string `json:"state"`
+    // Completion percentage, from 0 to 100.
+    Progress int `json:"progress"`
+    // Human readable progress message.
+    Message string `json:"message"`
+    // Number of attempts started.
+    Attempts int `json:"attempts"`
+    // Error message of the most recent failed attempt.
+    Error string `json:"error"`
+    // Reply of the originating method once SUCCEEDED, e.g. a CreateResourceResponse.
+    Result interface{} `json:"result"`
+}
+
+// Operations are held in the server's memory, not the entitlement store. They
+// are lost when the server restarts, after which GetOperationStatus reports the
+// operation as not found, and are forgotten 24 hours after finishing. Operations
+// queued but not started at shutdown are abandoned.
+type GetOperationStatusRequest struct {
+    // Account ID owning the operation.
+    AccountId string `json:"accountId"`
+    // Operation ID returned by the originating method.
+    OperationId string `json:"operationId"`
+}
+
+type GetOperationStatusResponse struct {
+    // Current operation status.
+    Operation Operation `json:"operation"`
+}
@@ -11,7 +11,7 @@ type RichText struct {
     // Valid values: "plain", "markdown"
     Format string `json:"format"`
     // Encoded content
-    Content string `json:"content"`
+    Content string `json:"content" redact:"true"`
 }
 
 type Address struct {
@@ -20,38 +20,38 @@ type Address struct {
     // Address type. Valid values: 'PRIMARY', 'BILLING', 'SHIPPING'
     AddressType string `json:"addressType"`
     // Street address line 1
-    Line1 string `json:"line1"`
+    Line1 string `json:"line1" redact:"true"`
     // Street address line 2
-    Line2 string `json:"line2"`
+    Line2 string `json:"line2" redact:"true"`
     // City or local jurisdiction
-    City string `json:"city"`
+    City string `json:"city" redact:"true"`
     // State or province code
     State string `json:"state"`
     // Two-letter ISO country code
     Country string `json:"country"`
     // Postal code
-    PostalCode string `json:"postalCode"`
+    PostalCode string `json:"postalCode" redact:"true"`
 }
 
 type OpenAccountRequest struct {
     // Account ID to create
     AccountId string `json:"accountId"`
     // Account name
-    Name string `json:"name"`
+    Name string `json:"name" redact:"true"`
     // Address info
     Addresses []Address `json:"addresses"`
 }
 
 type OpenAccountResponse struct {
     // Optional vendor-defined data to attach to the account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
 }
 
 type CloseAccountRequest struct {
     // Account ID to terminate.
     AccountId string `json:"accountId"`
     // Vendor-defined data associated with this account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
 }
 
 type CloseAccountResponse struct {
@@ -66,13 +66,13 @@ type CreateSubscriptionRequest struct {
     // SKU to subscribe.
     Sku int64 `json:"sku"`
     // Vendor-defined data for the account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
 }
 
 type CreateSubscriptionResponse struct {
     // Vendor-defined data. You may use this field to return ID's or tokens mapping this
     // subscription to your internal application identifiers.
-    SubscriptionData Metadata `json:"subscriptionData"`
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
     // URL to access this subscription.
     Url string `json:"url"`
     // Human readable instructions to access this subscription.
@@ -87,15 +87,80 @@ type TerminateSubscriptionRequest struct {
     // SKU for the subscription.
     Sku int64 `json:"sku"`
     // Vendor-defined data for the account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
     // Vendor-defined data for the subscription.
-    SubscriptionData Metadata `json:"subscriptionData"`
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
 }
 
 type TerminateSubscriptionResponse struct {
     // Empty
 }
 
+type UpdateSubscriptionRequest struct {
+    // Account ID owning the subscription.
+    AccountId string `json:"accountId"`
+    // Subscription ID to update.
+    SubscriptionId string `json:"subscriptionId"`
+    // SKU currently subscribed.
+    OldSku int64 `json:"oldSku"`
+    // SKU to change the subscription to.
+    NewSku int64 `json:"newSku"`
+    // Vendor-defined data for the account.
+    AccountData Metadata `json:"accountData" redact:"metadata"`
+    // Vendor-defined data for the subscription.
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
+}
+
+type UpdateSubscriptionResponse struct {
+    // Updated vendor-defined data. Replaces the existing SubscriptionData when set.
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
+    // URL to access this subscription. Replaces the existing URL when set.
+    Url string `json:"url"`
+    // Human readable instructions to access this subscription. Replaces the existing
+    // instructions when set.
+    Instructions RichText `json:"instructions"`
+}
+
+type SuspendSubscriptionRequest struct {
+    // Account ID owning the subscription.
+    AccountId string `json:"accountId"`
+    // Subscription ID to suspend.
+    SubscriptionId string `json:"subscriptionId"`
+    // SKU for the subscription.
+    Sku int64 `json:"sku"`
+    // Platform reason code for the suspension, e.g. 'NON_PAYMENT', 'FRAUD_REVIEW' or 'ADMINISTRATIVE'.
+    // Passed through unchecked, so implementations should tolerate new codes.
+    Reason string `json:"reason"`
+    // Vendor-defined data for the account.
+    AccountData Metadata `json:"accountData" redact:"metadata"`
+    // Vendor-defined data for the subscription.
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
+}
+
+type SuspendSubscriptionResponse struct {
+    // Empty
+}
+
+type ResumeSubscriptionRequest struct {
+    // Account ID owning the subscription.
+    AccountId string `json:"accountId"`
+    // Subscription ID to resume.
+    SubscriptionId string `json:"subscriptionId"`
+    // SKU for the subscription.
+    Sku int64 `json:"sku"`
+    // Platform reason code given when the subscription was suspended, e.g. 'NON_PAYMENT'.
+    // Passed through unchecked, so implementations should tolerate new codes.
+    Reason string `json:"reason"`
+    // Vendor-defined data for the account.
+    AccountData Metadata `json:"accountData" redact:"metadata"`
+    // Vendor-defined data for the subscription.
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
+}
+
+type ResumeSubscriptionResponse struct {
+    // Empty
+}
+
 type CreateResourceRequest struct {
     // Account ID owning the resource.
     AccountId string `json:"accountId"`
@@ -106,22 +171,60 @@ type CreateResourceRequest struct {
     // SKU for the subscription.
     Sku int64 `json:"sku"`
     // Resource name assigned by the user.
-    ResourceName string `json:"resourceName"`
+    ResourceName string `json:"resourceName" redact:"true"`
     // Vendor-defined configuration for this SKU.
-    Configuration json.RawMessage `json:"configuration"`
+    Configuration json.RawMessage `json:"configuration" redact:"true"`
     // Vendor-defined data for the account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
     // Vendor-defined data for the subscription.
-    SubscriptionData Metadata `json:"subscriptionData"`
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
 }
 
 type CreateResourceResponse struct {
     // URL to access this resource
     Url string `json:"url"`
     // Vendor-defined data associated with this resource.
-    ResourceData Metadata `json:"resourceData"`
+    ResourceData Metadata `json:"resourceData" redact:"metadata"`
     // Human readable instructions to access this resource.
     Instructions RichText `json:"instructions"`
+    // Set when the resource is provisioned asynchronously. Poll GetOperationStatus
+    // until it completes; the final reply is returned as the operation result.
+    Operation *Operation `json:"operation,omitempty"`
+}
+
+type UpdateResourceRequest struct {
+    // Account ID owning the resource.
+    AccountId string `json:"accountId"`
+    // Subscription ID associated with the resource.
+    SubscriptionId string `json:"subscriptionId"`
+    // Resource ID to update.
+    ResourceId string `json:"resourceId"`
+    // SKU for the subscription.
+    Sku int64 `json:"sku"`
+    // Resource name currently assigned by the user.
+    PreviousResourceName string `json:"previousResourceName" redact:"true"`
+    // New resource name assigned by the user.
+    ResourceName string `json:"resourceName" redact:"true"`
+    // Vendor-defined configuration currently applied to this resource.
+    PreviousConfiguration json.RawMessage `json:"previousConfiguration" redact:"true"`
+    // New vendor-defined configuration for this SKU.
+    Configuration json.RawMessage `json:"configuration" redact:"true"`
+    // Vendor-defined data for the account.
+    AccountData Metadata `json:"accountData" redact:"metadata"`
+    // Vendor-defined data for the subscription.
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
+    // Vendor-defined data for the resource.
+    ResourceData Metadata `json:"resourceData" redact:"metadata"`
+}
+
+type UpdateResourceResponse struct {
+    // URL to access this resource. Replaces the existing URL when set.
+    Url string `json:"url"`
+    // Updated vendor-defined data. Replaces the existing ResourceData when set.
+    ResourceData Metadata `json:"resourceData" redact:"metadata"`
+    // Human readable instructions to access this resource. Replaces the existing
+    // instructions when set.
+    Instructions RichText `json:"instructions"`
 }
 
 type TerminateResourceRequest struct {
@@ -134,17 +237,19 @@ type TerminateResourceRequest struct {
     // SKU for the subscription resource.
     Sku int64 `json:"sku"`
     // Resource name assigned by the user.
-    ResourceName string `json:"resourceName"`
+    ResourceName string `json:"resourceName" redact:"true"`
     // Vendor-defined data for the account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
     // Vendor-defined data for the subscription.
-    SubscriptionData Metadata `json:"subscriptionData"`
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
     // Vendor-defined data for the resource.
-    ResourceData Metadata `json:"resourceData"`
+    ResourceData Metadata `json:"resourceData" redact:"metadata"`
 }
 
 type TerminateResourceResponse struct {
-    // Empty
+    // Set when the resource is terminated asynchronously. Poll GetOperationStatus
+    // until it completes.
+    Operation *Operation `json:"operation,omitempty"`
 }
 
 type Initializable interface {
@@ -169,12 +274,24 @@ type SubscriptionServiceInterface interface {
     // Create a new subscription.
     CreateSubscription(request *http.Request, args *CreateSubscriptionRequest, reply *CreateSubscriptionResponse) error
 
+    // Change the SKU of an existing subscription.
+    UpdateSubscription(request *http.Request, args *UpdateSubscriptionRequest, reply *UpdateSubscriptionResponse) error
+
+    // Lock out access to a subscription while preserving its data, e.g. for a billing hold.
+    SuspendSubscription(request *http.Request, args *SuspendSubscriptionRequest, reply *SuspendSubscriptionResponse) error
+
+    // Restore access to a suspended subscription.
+    ResumeSubscription(request *http.Request, args *ResumeSubscriptionRequest, reply *ResumeSubscriptionResponse) error
+
     // Terminate an existing subscription.
     TerminateSubscription(request *http.Request, args *TerminateSubscriptionRequest, reply *TerminateSubscriptionResponse) error
 
     // Create a new resource in a subscription.
     CreateResource(request *http.Request, args *CreateResourceRequest, reply *CreateResourceResponse) error
 
+    // Reconfigure or rename a resource in a subscription.
+    UpdateResource(request *http.Request, args *UpdateResourceRequest, reply *UpdateResourceResponse) error
+
     // Terminate a resource in a subscription.
     TerminateResource(request *http.Request, args *TerminateResourceRequest, reply *TerminateResourceResponse) error
 
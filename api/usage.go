@@ -8,9 +8,9 @@ type GetSubscriptionUsageRequest struct {
     // SKU for the subscription.
     Sku int64 `json:"sku"`
     // Vendor-defined data for the account.
-    AccountData Metadata `json:"accountData"`
+    AccountData Metadata `json:"accountData" redact:"metadata"`
     // Vendor-defined data for the subscription.
-    SubscriptionData Metadata `json:"subscriptionData"`
+    SubscriptionData Metadata `json:"subscriptionData" redact:"metadata"`
     // Query time period start date-time in RFC 3339 format. Inclusive.
     StartTime string `json:"startTime"`
     // Query time period end date-time in RFC 3339 format. Exclusive.
@@ -40,7 +40,7 @@ type SubscriptionUsage struct {
     ResourceId string `json:"resourceId"`
     // Resource Name, when tied to a specific resource.
     // Prefer resource ID when available.
-    ResourceName string `json:"resourceName"`
+    ResourceName string `json:"resourceName" redact:"true"`
 }
 
 type GetSubscriptionUsageResponse struct {
@@ -0,0 +1,231 @@
+// Package audit writes a tamper-evident log of RPCs. Records are appended to a
+// JSON Lines file, each carrying the hash of the previous record, so any edit,
+// deletion or reordering breaks the chain from that point on. Hashes are HMACs
+// under a secret key, so the chain cannot be recomputed after a rewrite without
+// the key. Truncation leaves a valid chain; detect it by comparing the head
+// hash against one recorded elsewhere, e.g. the server log on shutdown.
+package audit
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/jupitercloud/subscribed/logger"
+)
+
+var log = logger.Named("audit");
+
+// RPC outcomes.
+const (
+    OutcomeSuccess = "success"
+    OutcomeError = "error"
+    // Rejected before reaching the method, e.g. for an unknown method.
+    OutcomeRejected = "rejected"
+)
+
+// Minimum length of the key chaining record hashes.
+const MinKeyLength = 32
+
+type Record struct {
+    Time time.Time `json:"time"`
+    // RPC method, e.g. "CreateSubscription"
+    Method string `json:"method"`
+    // X-Request-Id of the HTTP request, correlating with access logs
+    RequestId string `json:"requestId,omitempty"`
+    // Caller identity, from the token claims
+    VendorId string `json:"vendorId,omitempty"`
+    TokenAccountId string `json:"tokenAccountId,omitempty"`
+    Subject string `json:"subject,omitempty"`
+    TokenId string `json:"tokenId,omitempty"`
+    // Verified TLS client certificate, when mutual TLS is configured
+    ClientCommonName string `json:"clientCommonName,omitempty"`
+    // Entities the request acts on
+    AccountId string `json:"accountId,omitempty"`
+    SubscriptionId string `json:"subscriptionId,omitempty"`
+    ResourceId string `json:"resourceId,omitempty"`
+    OperationId string `json:"operationId,omitempty"`
+    Outcome string `json:"outcome"`
+    // json2 error code, when Outcome is OutcomeError
+    ErrorCode int `json:"errorCode,omitempty"`
+    LatencyMs float64 `json:"latencyMs"`
+    // Hash of the previous record. Empty for the first record in a file.
+    PrevHash string `json:"prevHash"`
+    // HMAC-SHA256 of this record, with Hash empty.
+    Hash string `json:"hash"`
+}
+
+// Compute the record's chained hash.
+func (r Record) computeHash(key []byte) (string, error) {
+    r.Hash = ""
+    encoded, err := json.Marshal(r)
+    if err != nil {
+        return "", err
+    }
+    mac := hmac.New(sha256.New, key)
+    mac.Write(encoded)
+    return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// An append-only audit log file.
+type Log struct {
+    path string
+    key []byte
+    mutex sync.Mutex
+    file *os.File
+    lastHash string
+}
+
+// Open the log for appending, continuing the chain from its last record. An
+// existing file must verify under the key.
+func (l *Log) Initialize(ctx context.Context) error {
+    log.Info("Opening audit log", "path", l.path)
+    if len(l.key) < MinKeyLength {
+        return fmt.Errorf("audit key must be at least %d bytes", MinKeyLength)
+    }
+    lastHash, err := l.verifyExisting()
+    if err != nil {
+        return err
+    }
+    file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        return err
+    }
+    l.mutex.Lock()
+    l.file = file
+    l.lastHash = lastHash
+    l.mutex.Unlock()
+    return nil
+}
+
+func (l *Log) Shutdown(ctx context.Context) error {
+    log.Debug("Closing audit log")
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    if l.file == nil {
+        return nil
+    }
+    err := l.file.Close()
+    l.file = nil
+    // Record the head outside the file, to detect later truncation.
+    log.Info("Closed audit log", "path", l.path, "head", l.lastHash)
+    return err
+}
+
+// Hash of the last record, or empty for an empty log. Keep it outside the
+// file, and pass it to Verify, to detect removal of the latest records.
+func (l *Log) Head() string {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    return l.lastHash
+}
+
+// Chain and append a record.
+func (l *Log) Append(record Record) error {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    if l.file == nil {
+        return fmt.Errorf("audit log not open")
+    }
+    record.PrevHash = l.lastHash
+    hash, err := record.computeHash(l.key)
+    if err != nil {
+        return err
+    }
+    record.Hash = hash
+    encoded, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    if _, err := l.file.Write(append(encoded, '\n')); err != nil {
+        return err
+    }
+    l.lastHash = hash
+    return nil
+}
+
+// Create an audit log appending to the file at path, chaining records with
+// an HMAC under key. The key must be kept secret, and at least MinKeyLength bytes.
+func NewLog(path string, key []byte) *Log {
+    return &Log{path: path, key: key}
+}
+
+// Read an audit key from a file, ignoring surrounding whitespace.
+func ReadKeyFile(path string) ([]byte, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return bytes.TrimSpace(data), nil
+}
+
+// Verify the existing file, returning its head hash, or empty for a new file.
+func (l *Log) verifyExisting() (string, error) {
+    file, err := os.Open(l.path)
+    if os.IsNotExist(err) {
+        return "", nil
+    }
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+
+    count, head, err := Verify(file, l.key)
+    if err != nil {
+        return "", fmt.Errorf("%s: verification failed after %d records: %w", l.path, count, err)
+    }
+    log.Info("Verified audit log", "path", l.path, "records", count, "head", head)
+    return head, nil
+}
+
+// Decode each record in a log, in order.
+func Read(reader io.Reader, fn func(record Record) error) error {
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+        var record Record
+        if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+            return fmt.Errorf("line %d: %w", line, err)
+        }
+        if err := fn(record); err != nil {
+            return fmt.Errorf("line %d: %w", line, err)
+        }
+    }
+    return scanner.Err()
+}
+
+// Verify the hash chain of a log under key, returning the number of records
+// checked and the head hash. Compare the head against a previously recorded
+// Head to detect truncation.
+func Verify(reader io.Reader, key []byte) (count int, head string, err error) {
+    err = Read(reader, func(record Record) error {
+        if record.PrevHash != head {
+            return fmt.Errorf("chain broken: expected prevHash %q, found %q", head, record.PrevHash)
+        }
+        hash, err := record.computeHash(key)
+        if err != nil {
+            return err
+        }
+        if !hmac.Equal([]byte(hash), []byte(record.Hash)) {
+            return fmt.Errorf("record modified or wrong key: hash %q does not verify", record.Hash)
+        }
+        head = record.Hash
+        count++
+        return nil
+    })
+    return count, head, err
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+    "bytes"
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// Append records for methods, returning the head hash on shutdown.
+func writeTestLog(t *testing.T, path string, key []byte, methods ...string) string {
+    l := NewLog(path, key)
+    if err := l.Initialize(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    for _, method := range methods {
+        record := Record{Time: time.Now().UTC(), Method: method, AccountId: "acct-1", Outcome: OutcomeSuccess}
+        if err := l.Append(record); err != nil {
+            t.Fatal(err)
+        }
+    }
+    head := l.Head()
+    if err := l.Shutdown(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    return head
+}
+
+func verifyFile(t *testing.T, path string, key []byte) (int, string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return Verify(bytes.NewReader(data), key)
+}
+
+func TestVerify(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    writeTestLog(t, path, testKey, "OpenAccount", "CreateSubscription")
+    // Reopening continues the chain.
+    expectedHead := writeTestLog(t, path, testKey, "TerminateSubscription")
+
+    count, head, err := verifyFile(t, path, testKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if count != 3 {
+        t.Fatalf("verified %d records, expected 3", count)
+    }
+    if head != expectedHead {
+        t.Fatalf("head %q, expected %q", head, expectedHead)
+    }
+}
+
+func TestVerifyDetectsEdit(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    writeTestLog(t, path, testKey, "OpenAccount", "CreateSubscription", "TerminateSubscription")
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    edited := strings.Replace(string(data), `"method":"CreateSubscription"`, `"method":"CloseAccount"`, 1)
+    if err := os.WriteFile(path, []byte(edited), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    count, _, err := verifyFile(t, path, testKey)
+    if err == nil || !strings.Contains(err.Error(), "record modified") {
+        t.Fatalf("expected a modified record error, got %v", err)
+    }
+    if count != 1 {
+        t.Fatalf("verified %d records before the edit, expected 1", count)
+    }
+}
+
+func TestVerifyDetectsDeletion(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    writeTestLog(t, path, testKey, "OpenAccount", "CreateSubscription", "TerminateSubscription")
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := strings.SplitAfter(string(data), "\n")
+    if err := os.WriteFile(path, []byte(lines[0] + lines[2]), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    if _, _, err := verifyFile(t, path, testKey); err == nil || !strings.Contains(err.Error(), "chain broken") {
+        t.Fatalf("expected a broken chain error, got %v", err)
+    }
+}
+
+// A log rewritten with a recomputed chain does not verify without the key.
+func TestVerifyDetectsRewrite(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    writeTestLog(t, path, testKey, "OpenAccount", "CloseAccount")
+    forged := filepath.Join(t.TempDir(), "audit.log")
+    writeTestLog(t, forged, []byte("an attacker's guess at the key.."), "OpenAccount")
+
+    if _, _, err := verifyFile(t, forged, testKey); err == nil || !strings.Contains(err.Error(), "record modified") {
+        t.Fatalf("expected a modified record error, got %v", err)
+    }
+}
+
+// Truncation leaves a valid chain, but the head no longer matches.
+func TestVerifyDetectsTruncation(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    head := writeTestLog(t, path, testKey, "OpenAccount", "CreateSubscription", "TerminateSubscription")
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := strings.SplitAfter(string(data), "\n")
+    if err := os.WriteFile(path, []byte(lines[0] + lines[1]), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    count, truncatedHead, err := verifyFile(t, path, testKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if count != 2 || truncatedHead == head {
+        t.Fatalf("verified %d records with head %q, expected 2 with a head other than %q", count, truncatedHead, head)
+    }
+}
+
+func TestInitializeRejectsTamperedLog(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    writeTestLog(t, path, testKey, "OpenAccount", "CreateSubscription")
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    edited := strings.Replace(string(data), `"acct-1"`, `"acct-2"`, 1)
+    if err := os.WriteFile(path, []byte(edited), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := NewLog(path, testKey).Initialize(context.Background()); err == nil {
+        t.Fatal("expected a tampered log to fail initialization")
+    }
+}
+
+func TestShortKey(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    if err := NewLog(path, []byte("short")).Initialize(context.Background()); err == nil {
+        t.Fatal("expected a short key to be rejected")
+    }
+}
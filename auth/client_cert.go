@@ -0,0 +1,97 @@
+package auth
+
+import (
+    "crypto/sha256"
+    "crypto/tls"
+    "encoding/hex"
+    "net/http"
+
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+// How a verified TLS client certificate combines with token authentication.
+const (
+    // Require both a client certificate and a token.
+    ClientCertAndToken = "and-token"
+    // Accept a client certificate instead of a token, for certificates named in
+    // Config.ClientCertSubjects. Certificate-only callers are trusted as the
+    // platform, with vendor-wide access and Config.ClientCertScopes. When
+    // hosting several vendors, they must call a per-vendor path.
+    ClientCertOrToken = "or-token"
+)
+
+// Identity from a client certificate verified against the configured CA.
+type ClientIdentity struct {
+    CommonName string
+    Organization []string
+    DNSNames []string
+    URIs []string
+    // Hex SHA-256 fingerprint of the DER encoded certificate.
+    Fingerprint string
+}
+
+// Identity of the verified client certificate on a connection, if any.
+func clientIdentity(state *tls.ConnectionState) *ClientIdentity {
+    if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+        return nil
+    }
+    cert := state.VerifiedChains[0][0]
+    identity := &ClientIdentity{
+        CommonName: cert.Subject.CommonName,
+        Organization: cert.Subject.Organization,
+        DNSNames: cert.DNSNames,
+    }
+    for _, uri := range cert.URIs {
+        identity.URIs = append(identity.URIs, uri.String())
+    }
+    fingerprint := sha256.Sum256(cert.Raw)
+    identity.Fingerprint = hex.EncodeToString(fingerprint[:])
+    return identity
+}
+
+// Report whether the certificate's common name, or one of its DNS or URI SANs,
+// is allowed to authenticate without a token.
+func (auth *authService) certificateAllowed(identity *ClientIdentity) bool {
+    if auth.clientCertSubjects[identity.CommonName] {
+        return true
+    }
+    for _, name := range identity.DNSNames {
+        if auth.clientCertSubjects[name] {
+            return true
+        }
+    }
+    for _, uri := range identity.URIs {
+        if auth.clientCertSubjects[uri] {
+            return true
+        }
+    }
+    log.Warn("Client certificate not allowed without a token", "common-name", identity.CommonName)
+    return false
+}
+
+// Read claims for a request, from its token and any verified client certificate.
+func (auth *authService) readClaims(request *http.Request) *Claims {
+    token := request.Header.Get("Authorization")
+    identity := clientIdentity(request.TLS)
+    if identity == nil && auth.clientCertMode == ClientCertAndToken {
+        return &Claims{Error: errors.ClientCertificateRequired()}
+    }
+    if identity != nil && token == "" && auth.clientCertMode == ClientCertOrToken && auth.certificateAllowed(identity) {
+        log.Debug("Authenticated by client certificate", "common-name", identity.CommonName)
+        claims := &Claims{Client: identity, Scopes: auth.clientCertScopes, certificateOnly: true}
+        // The vendor is implied when hosting only one, and otherwise set by the router.
+        if len(auth.vendorIds) == 1 {
+            claims.VendorId = auth.vendorIdList()[0]
+        }
+        return claims
+    }
+
+    var claims *Claims
+    if auth.devMode {
+        claims = auth.readDevToken(token)
+    } else {
+        claims = auth.readToken(request.Context(), token)
+    }
+    claims.Client = identity
+    return claims
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/coreos/go-oidc/v3/oidc"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/metric"
+    "go.opentelemetry.io/otel/trace"
+)
+
+const (
+    discoveryInitialDelay = time.Second
+    discoveryMaxDelay = time.Minute
+    // Limit on each discovery attempt and key set fetch, so an unresponsive
+    // issuer cannot block startup or stall the retries.
+    issuerTimeout = 10 * time.Second
+)
+
+// HTTP client for requests to the issuer.
+var issuerClient = &http.Client{Timeout: issuerTimeout}
+
+var meter = otel.Meter("auth")
+
+// Counts failures to fetch the issuer's key set after discovery.
+var keySetRefreshFailures, _ = meter.Int64Counter("auth.keyset.refresh_failures",
+    metric.WithDescription("Failures to fetch the token issuer's JSON Web Key Set"))
+
+// Wraps the issuer's remote key set, surfacing key fetch failures which the
+// verifier would otherwise report as an invalid token.
+type observedKeySet struct {
+    jwksUrl string
+    inner oidc.KeySet
+}
+
+func (s *observedKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+    payload, err := s.inner.VerifySignature(ctx, jwt)
+    // RemoteKeySet reports fetch failures with this prefix.
+    if err != nil && strings.HasPrefix(err.Error(), "fetching keys") {
+        log.Error("Failed to refresh issuer key set", "jwks-uri", s.jwksUrl, "error", err)
+        keySetRefreshFailures.Add(ctx, 1)
+        trace.SpanFromContext(ctx).AddEvent("auth.keyset.refresh_failed", trace.WithAttributes(
+            attribute.String("auth.jwks_uri", s.jwksUrl),
+            attribute.String("error", err.Error()),
+        ))
+    }
+    return payload, err
+}
+
+// Run OIDC discovery against the issuer, and install a verifier for its keys.
+func (auth *authService) discover(ctx context.Context) error {
+    ctx, cancel := context.WithTimeout(oidc.ClientContext(ctx, issuerClient), issuerTimeout)
+    defer cancel()
+    provider, err := oidc.NewProvider(ctx, auth.issuer)
+    if err != nil {
+        return err
+    }
+
+    var metadata struct {
+        JwksUrl string `json:"jwks_uri"`
+        Algorithms []string `json:"id_token_signing_alg_values_supported"`
+    }
+    if err := provider.Claims(&metadata); err != nil {
+        return err
+    }
+
+    keySet := &observedKeySet{
+        jwksUrl: metadata.JwksUrl,
+        inner: oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), issuerClient), metadata.JwksUrl),
+    }
+    auth.verifier.Store(auth.newVerifier(keySet, metadata.Algorithms))
+    log.Info("OIDC discovery complete", "issuer", auth.issuer, "jwks-uri", metadata.JwksUrl)
+    return nil
+}
+
+// Retry discovery with exponential backoff until it succeeds or ctx is done.
+func (auth *authService) retryDiscovery(ctx context.Context) {
+    delay := discoveryInitialDelay
+    for {
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            return
+        }
+        err := auth.discover(ctx)
+        if err == nil {
+            return
+        }
+        delay *= 2
+        if delay > discoveryMaxDelay {
+            delay = discoveryMaxDelay
+        }
+        log.Warn("OIDC discovery failed, retrying", "issuer", auth.issuer, "delay", delay, "error", err)
+    }
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+    "context"
+    "net"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+func TestDiscoveryRetry(t *testing.T) {
+    // Reserve an address for an issuer which is not running yet.
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    address := listener.Addr().String()
+    listener.Close()
+    i, err := issuer.NewIssuer("http://" + address)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    auth := NewAuthService(Config{Issuer: i.URL(), VendorIds: []string{testVendorId}})
+    if err := auth.Initialize(context.Background()); err != nil {
+        t.Fatalf("an unreachable issuer failed initialization: %v", err)
+    }
+    defer auth.Shutdown(context.Background())
+    if auth.Ready() {
+        t.Fatal("ready before discovery")
+    }
+    token := mintFor(t, i)
+    if claims := auth.readToken(context.Background(), token); !errors.HasCode(claims.Error, errors.CodeAuthNotReady) {
+        t.Fatalf("expected AuthNotReady, got %v", claims.Error)
+    }
+
+    listener, err = net.Listen("tcp", address)
+    if err != nil {
+        t.Fatal(err)
+    }
+    server := &http.Server{Handler: i.Handler()}
+    go server.Serve(listener)
+    defer server.Close()
+
+    for deadline := time.Now().Add(5 * time.Second); !auth.Ready(); {
+        if time.Now().After(deadline) {
+            t.Fatal("discovery not retried")
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+    if claims := auth.readToken(context.Background(), token); claims.Error != nil {
+        t.Fatalf("token rejected after discovery: %v", claims.Error)
+    }
+}
+
+func TestDevModeSkipsDiscovery(t *testing.T) {
+    // The issuer is never contacted in development mode.
+    auth := NewAuthService(Config{Issuer: "http://127.0.0.1:1", VendorIds: []string{testVendorId}, DevMode: true})
+    if err := auth.Initialize(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    defer auth.Shutdown(context.Background())
+    if !auth.Ready() {
+        t.Fatal("development mode not ready")
+    }
+    if auth.verifier.Load() != nil || auth.cancel != nil {
+        t.Fatal("development mode ran discovery")
+    }
+    claims := auth.readDevToken(`{"https://jupitercloud.com/vendorId": "vendor-1"}`)
+    if claims.Error != nil || claims.VendorId != testVendorId {
+        t.Fatalf("unexpected dev claims: %+v", claims)
+    }
+}
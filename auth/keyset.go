@@ -0,0 +1,153 @@
+package auth
+
+import (
+    "bytes"
+    "context"
+    "crypto/x509"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/go-jose/go-jose/v3"
+)
+
+// Signing algorithms accepted from a key file. Discovery advertises its own.
+var keyFileSigningAlgs = []string{
+    string(jose.RS256), string(jose.RS384), string(jose.RS512),
+    string(jose.ES256), string(jose.ES384), string(jose.ES512),
+    string(jose.PS256), string(jose.PS384), string(jose.PS512),
+    string(jose.EdDSA),
+}
+
+// A key set loaded from a JWKS document or PEM public keys on disk, as an
+// alternative to OIDC discovery. The file is reloaded periodically, so keys
+// can be rotated without a restart.
+type fileKeySet struct {
+    path string
+    mutex sync.RWMutex
+    keys []jose.JSONWebKey
+    modTime time.Time
+}
+
+// Parse a JWKS document, or a bundle of PEM encoded public keys and certificates.
+func parseKeys(data []byte) ([]jose.JSONWebKey, error) {
+    trimmed := bytes.TrimSpace(data)
+    if bytes.HasPrefix(trimmed, []byte("{")) {
+        var jwks jose.JSONWebKeySet
+        if err := json.Unmarshal(trimmed, &jwks); err != nil {
+            return nil, fmt.Errorf("invalid JWKS: %w", err)
+        }
+        return jwks.Keys, nil
+    }
+
+    var keys []jose.JSONWebKey
+    for {
+        var block *pem.Block
+        block, data = pem.Decode(data)
+        if block == nil {
+            break
+        }
+        var key interface{}
+        var err error
+        switch block.Type {
+        case "PUBLIC KEY":
+            key, err = x509.ParsePKIXPublicKey(block.Bytes)
+        case "RSA PUBLIC KEY":
+            key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+        case "CERTIFICATE":
+            var cert *x509.Certificate
+            cert, err = x509.ParseCertificate(block.Bytes)
+            if err == nil {
+                key = cert.PublicKey
+            }
+        default:
+            return nil, fmt.Errorf("unsupported PEM block: %s", block.Type)
+        }
+        if err != nil {
+            return nil, err
+        }
+        keys = append(keys, jose.JSONWebKey{Key: key})
+    }
+    if len(keys) == 0 {
+        return nil, fmt.Errorf("no keys found")
+    }
+    return keys, nil
+}
+
+// Load the key file if it changed since the last load.
+func (s *fileKeySet) reload() error {
+    info, err := os.Stat(s.path)
+    if err != nil {
+        return err
+    }
+    s.mutex.RLock()
+    unchanged := info.ModTime().Equal(s.modTime)
+    s.mutex.RUnlock()
+    if unchanged {
+        return nil
+    }
+
+    data, err := os.ReadFile(s.path)
+    if err != nil {
+        return err
+    }
+    keys, err := parseKeys(data)
+    if err != nil {
+        return fmt.Errorf("%s: %w", s.path, err)
+    }
+
+    s.mutex.Lock()
+    s.keys = keys
+    s.modTime = info.ModTime()
+    s.mutex.Unlock()
+    log.Info("Loaded verification keys", "path", s.path, "keys", len(keys))
+    return nil
+}
+
+// Reload the key file every interval until ctx is done. Failures keep the previous keys.
+func (s *fileKeySet) watch(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            if err := s.reload(); err != nil {
+                log.Error("Failed to reload verification keys", "path", s.path, "error", err)
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Implements oidc.KeySet.
+func (s *fileKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+    jws, err := jose.ParseSigned(jwt)
+    if err != nil {
+        return nil, fmt.Errorf("parsing jwt: %v", err)
+    }
+    keyId := ""
+    if len(jws.Signatures) > 0 {
+        keyId = jws.Signatures[0].Header.KeyID
+    }
+
+    s.mutex.RLock()
+    defer s.mutex.RUnlock()
+    for _, key := range s.keys {
+        // Keys without an ID, e.g. from PEM, are tried for every token.
+        if keyId != "" && key.KeyID != "" && key.KeyID != keyId {
+            continue
+        }
+        if payload, err := jws.Verify(key.Key); err == nil {
+            return payload, nil
+        }
+    }
+    return nil, fmt.Errorf("no verification key able to verify jwt")
+}
+
+func newFileKeySet(path string) *fileKeySet {
+    return &fileKeySet{path: path}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+    "context"
+    "crypto/x509"
+    "encoding/json"
+    "encoding/pem"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+const testVendorId = "vendor-1"
+
+const testIssuerUrl = "https://issuer.example.com"
+
+// Write an issuer's public keys to path as a JWKS document, stamped with modTime.
+func writeKeyFile(t *testing.T, path string, i *issuer.Issuer, modTime time.Time) {
+    t.Helper()
+    data, err := json.Marshal(i.JWKS())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(path, data, 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chtimes(path, modTime, modTime); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func newTestIssuer(t *testing.T) *issuer.Issuer {
+    i, err := issuer.NewIssuer(testIssuerUrl)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return i
+}
+
+func mintFor(t *testing.T, i *issuer.Issuer) string {
+    token, err := i.Mint(issuer.TokenClaims{VendorId: testVendorId})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return token
+}
+
+func TestParsePemKeys(t *testing.T) {
+    i := newTestIssuer(t)
+    der, err := x509.MarshalPKIXPublicKey(i.JWKS().Keys[0].Key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keys, err := parseKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(keys) != 1 {
+        t.Fatalf("parsed %d keys, expected 1", len(keys))
+    }
+    if _, err := parseKeys([]byte("not a key")); err == nil {
+        t.Fatal("expected an error for a file without keys")
+    }
+    if _, err := parseKeys(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{0}})); err == nil {
+        t.Fatal("expected private keys to be rejected")
+    }
+}
+
+func TestKeyFileReload(t *testing.T) {
+    before, after := newTestIssuer(t), newTestIssuer(t)
+    path := filepath.Join(t.TempDir(), "keys.json")
+    start := time.Now().Add(-time.Hour)
+    writeKeyFile(t, path, before, start)
+
+    auth := NewAuthService(Config{
+        Issuer: testIssuerUrl,
+        VendorIds: []string{testVendorId},
+        KeyFile: path,
+        KeyReloadInterval: 10 * time.Millisecond,
+    })
+    if err := auth.Initialize(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    defer auth.Shutdown(context.Background())
+
+    ctx := context.Background()
+    if claims := auth.readToken(ctx, mintFor(t, before)); claims.Error != nil {
+        t.Fatalf("token rejected: %v", claims.Error)
+    }
+    if claims := auth.readToken(ctx, mintFor(t, after)); !errors.HasCode(claims.Error, errors.CodeJwtError) {
+        t.Fatalf("expected a token from an unknown key to be rejected, got %v", claims.Error)
+    }
+
+    // Rotate the keys.
+    writeKeyFile(t, path, after, start.Add(time.Minute))
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        if claims := auth.readToken(ctx, mintFor(t, after)); claims.Error == nil {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("rotated key not loaded")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    if claims := auth.readToken(ctx, mintFor(t, before)); claims.Error == nil {
+        t.Fatal("expected a token from the retired key to be rejected")
+    }
+
+    // An invalid file keeps the previous keys.
+    if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(50 * time.Millisecond)
+    if claims := auth.readToken(ctx, mintFor(t, after)); claims.Error != nil {
+        t.Fatalf("keys lost after an invalid reload: %v", claims.Error)
+    }
+}
+
+func TestMissingKeyFile(t *testing.T) {
+    auth := NewAuthService(Config{Issuer: testIssuerUrl, KeyFile: filepath.Join(t.TempDir(), "missing.json")})
+    if err := auth.Initialize(context.Background()); err == nil {
+        t.Fatal("expected a missing key file to fail initialization")
+    }
+    auth.Shutdown(context.Background())
+}
@@ -4,10 +4,16 @@ import (
     "context"
     "encoding/json"
     "net/http"
+    "strings"
+    "sync/atomic"
+    "time"
 
     "github.com/coreos/go-oidc/v3/oidc"
+    "github.com/gorilla/rpc/v2/json2"
     "github.com/jupitercloud/subscribed/errors"
     "github.com/jupitercloud/subscribed/logger"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/metric"
 )
 
 var log = logger.Named("auth");
@@ -15,18 +21,104 @@ var log = logger.Named("auth");
 type Claims struct {
     // Failure to parse claims
     Error error
-    // The JWT *MUST* have a vendorId claim matching our vendor ID.
+    // The JWT *MUST* have a vendorId claim matching one of our vendor IDs.
     VendorId string `json:"https://jupitercloud.com/vendorId"`
     // Account ID scope authorized for this token.
     AccountId string `json:"https://jupitercloud.com/accountId"`
+    // Scopes granted to this token, from the standard scope claim.
+    Scopes Scopes `json:"scope"`
+    // Token subject.
+    Subject string `json:"sub"`
+    // Unique token ID, checked for replays.
+    TokenId string `json:"jti"`
+    // Token expiry. Zero for development tokens.
+    Expiry time.Time `json:"-"`
+    // Verified TLS client certificate identity, when mutual TLS is configured.
+    Client *ClientIdentity `json:"-"`
+    // Authenticated by client certificate alone, see ClientCertOrToken.
+    // Scopes are then Config.ClientCertScopes.
+    certificateOnly bool
+}
+
+// Report whether the token was granted scope.
+func (claims *Claims) HasScope(scope string) bool {
+    for _, granted := range claims.Scopes {
+        if granted == scope {
+            return true
+        }
+    }
+    return false
+}
+
+// Token scopes. Decodes either a space-delimited string (RFC 8693) or an array of strings.
+type Scopes []string
+
+func (scopes *Scopes) UnmarshalJSON(data []byte) error {
+    var delimited string
+    if err := json.Unmarshal(data, &delimited); err == nil {
+        *scopes = strings.Fields(delimited)
+        return nil
+    }
+    var list []string
+    if err := json.Unmarshal(data, &list); err != nil {
+        return err
+    }
+    *scopes = list
+    return nil
+}
+
+type Config struct {
+    // OIDC compatible token issuer URL
+    Issuer string
+    // Vendor IDs operated by this server
+    VendorIds []string
+    // Development mode - claims are read from the raw Authorization header.
+    DevMode bool
+    // Optional JWKS or PEM public key file. When set, tokens are verified against
+    // these keys instead of keys found through OIDC discovery.
+    KeyFile string
+    // Interval between checks of KeyFile for rotated keys. Defaults to one minute.
+    KeyReloadInterval time.Duration
+    // Accepted token audiences. When set, the aud claim must name one of them.
+    Audiences []string
+    // Allowed clock skew when checking exp, nbf and iat. Defaults to DefaultClockSkew;
+    // a negative value checks without leeway.
+    ClockSkew time.Duration
+    // Maximum time since a token was issued. Zero accepts any age until expiry.
+    MaxTokenAge time.Duration
+    // Required azp claim, e.g. the platform's client ID. Empty accepts any.
+    AuthorizedParty string
+    // Optional cache of seen token IDs. When set, tokens may be used only once
+    // for ReplayProtectedMethods.
+    ReplayCache ReplayCache
+    // RPC method names, e.g. "TerminateResource", rejecting a reused jti.
+    ReplayProtectedMethods []string
+    // When set, ClientCertAndToken or ClientCertOrToken. The server must request
+    // client certificates and verify them against the platform's CA.
+    ClientCertMode string
+    // Certificate common names, DNS or URI SANs which may authenticate without a
+    // token in ClientCertOrToken mode. Other certificates must present a token.
+    ClientCertSubjects []string
+    // Scopes granted to callers authenticated by certificate alone.
+    ClientCertScopes []string
 }
 
 type authService struct {
     issuer string
-    vendorId string
+    vendorIds map[string]bool
     devMode bool
-    provider *oidc.Provider
-    verifier *oidc.IDTokenVerifier
+    keyFile string
+    keyReloadInterval time.Duration
+    policy tokenPolicy
+    replayCache ReplayCache
+    replayMethods map[string]bool
+    clientCertMode string
+    clientCertSubjects map[string]bool
+    clientCertScopes Scopes
+    // Set once keys are available, which may be after Initialize returns.
+    verifier atomic.Pointer[oidc.IDTokenVerifier]
+    // Stops background discovery and the key file watcher.
+    cancel context.CancelFunc
 }
 
 
@@ -36,17 +128,27 @@ func (auth *authService) readToken(ctx context.Context, tokenString string) *Cla
         claims.Error = errors.Unauthenticated()
         return &claims
     }
-    token, err := auth.verifier.Verify(ctx, tokenString)
+    verifier := auth.verifier.Load()
+    if verifier == nil {
+        claims.Error = errors.AuthNotReady()
+        return &claims
+    }
+    token, err := verifier.Verify(ctx, tokenString)
     if err != nil {
         claims.Error = errors.JwtError(err)
         return &claims
     }
+    if err := auth.policy.check(token, time.Now()); err != nil {
+        claims.Error = err
+        return &claims
+    }
     err = token.Claims(&claims)
     if err != nil {
         claims.Error = errors.JwtError(err)
         return &claims
     }
-    if claims.VendorId != auth.vendorId {
+    claims.Expiry = token.Expiry
+    if !auth.vendorIds[claims.VendorId] {
         claims.Error = errors.InvalidVendorIdClaim()
         return &claims
     }
@@ -54,7 +156,7 @@ func (auth *authService) readToken(ctx context.Context, tokenString string) *Cla
 }
 
 func (auth *authService) readDevToken(tokenString string) *Claims {
-    log.Debug("Reading dev token", "token", tokenString)
+    log.Debug("Reading dev token")
     // In development mode, the Authorization claims are parsed as raw JSON string.
     var claims Claims
     if (tokenString == "") {
@@ -66,42 +168,122 @@ func (auth *authService) readDevToken(tokenString string) *Claims {
         claims.Error = errors.JwtError(err)
         return &claims
     }
-    if claims.VendorId != auth.vendorId {
+    if !auth.vendorIds[claims.VendorId] {
         claims.Error = errors.InvalidVendorIdClaim()
         return &claims
     }
     return &claims
 }
 
+// Report whether tokens can be verified. Until OIDC discovery succeeds,
+// every token is rejected with errors.AuthNotReady.
+func (auth *authService) Ready() bool {
+    return auth.devMode || auth.verifier.Load() != nil
+}
+
+// Initialize token verification. Failure to reach the issuer is not fatal:
+// discovery is retried in the background while the server starts. Development
+// mode reads raw claims, so neither discovery nor a key file is used.
 func (auth *authService) Initialize(ctx context.Context) error {
-    log.Info("Initializing authorization service", "issuer", auth.issuer, "vendor-id", auth.vendorId)
-    provider, err := oidc.NewProvider(ctx, auth.issuer)
+    if auth.devMode {
+        log.Warn("Development mode: token signatures are not verified", "vendor-ids", auth.vendorIdList())
+        return nil
+    }
+    backgroundCtx, cancel := context.WithCancel(context.Background())
+    auth.cancel = cancel
+
+    if auth.keyFile != "" {
+        return auth.initializeKeyFile(backgroundCtx)
+    }
 
+    log.Info("Initializing authorization service", "issuer", auth.issuer, "vendor-ids", auth.vendorIdList())
+    err := auth.discover(ctx)
     if err != nil {
+        log.Warn("OIDC discovery failed, retrying in background", "issuer", auth.issuer, "error", err)
+        go auth.retryDiscovery(backgroundCtx)
+    }
+    return nil
+}
+
+// Verify tokens against keys loaded from disk, without contacting the issuer.
+func (auth *authService) initializeKeyFile(ctx context.Context) error {
+    log.Info("Initializing authorization service from key file", "issuer", auth.issuer, "vendor-ids", auth.vendorIdList(), "key-file", auth.keyFile)
+    keySet := newFileKeySet(auth.keyFile)
+    if err := keySet.reload(); err != nil {
         return err
     }
 
-    auth.provider = provider
-    // No client ID, as we are not executing a full OIDC handshake.
-    auth.verifier = provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
+    auth.verifier.Store(auth.newVerifier(keySet, keyFileSigningAlgs))
+
+    go keySet.watch(ctx, auth.keyReloadInterval)
     return nil
 }
 
+func (auth *authService) vendorIdList() []string {
+    var list []string
+    for vendorId := range auth.vendorIds {
+        list = append(list, vendorId)
+    }
+    return list
+}
 
 func (auth *authService) Shutdown(ctx context.Context) error {
     log.Debug("Shutting down authorization service")
+    if auth.cancel != nil {
+        auth.cancel()
+    }
     return nil
 }
 
+// Counts rejected requests, by failureReason.
+var authFailures, _ = meter.Int64Counter("auth.failures",
+    metric.WithDescription("Requests rejected by token or client certificate verification"))
+
+// Short reason for an authentication failure, recorded as a metric attribute.
+func failureReason(err error) string {
+    rpcErr, ok := err.(*json2.Error)
+    if !ok {
+        return "other"
+    }
+    switch rpcErr.Code {
+    case errors.CodeUnauthenticated:
+        return "unauthenticated"
+    case errors.CodeInvalidVendorIdClaim:
+        return "invalid_vendor_id"
+    case errors.CodeJwtError:
+        return "invalid_token"
+    case errors.CodeAuthNotReady:
+        return "not_ready"
+    case errors.CodeTokenExpired:
+        return "expired"
+    case errors.CodeTokenNotYetValid:
+        return "not_yet_valid"
+    case errors.CodeTokenTooOld:
+        return "too_old"
+    case errors.CodeInvalidAudience:
+        return "invalid_audience"
+    case errors.CodeInvalidAuthorizedParty:
+        return "invalid_authorized_party"
+    case errors.CodeTokenReplayed:
+        return "replayed"
+    case errors.CodeMissingTokenId:
+        return "missing_token_id"
+    case errors.CodeClientCertificateRequired:
+        return "client_certificate_required"
+    }
+    return "other"
+}
+
 func (auth *authService) Middleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
         ctx := request.Context()
-        token := request.Header.Get("Authorization")
-        var claims *Claims
-        if auth.devMode {
-            claims = auth.readDevToken(token)
-        } else {
-            claims = auth.readToken(ctx, token)
+        claims := auth.readClaims(request)
+        if auth.replayCache != nil && claims.Error == nil {
+            auth.checkReplay(request, claims)
+        }
+        // Only RPCs are POSTed, so health probes and CORS preflights are not counted.
+        if claims.Error != nil && request.Method == http.MethodPost {
+            authFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", failureReason(claims.Error))))
         }
         ctx2 := context.WithValue(ctx, "claims", claims)
         request2 := request.WithContext(ctx2)
@@ -109,6 +291,45 @@ func (auth *authService) Middleware(next http.Handler) http.Handler {
     })
 }
 
-func NewAuthService(issuer string, vendorId string, devMode bool) *authService {
-    return &authService{issuer: issuer, vendorId: vendorId, devMode: devMode}
+func NewAuthService(config Config) *authService {
+    reloadInterval := config.KeyReloadInterval
+    if reloadInterval <= 0 {
+        reloadInterval = time.Minute
+    }
+    clockSkew := config.ClockSkew
+    if clockSkew == 0 {
+        clockSkew = DefaultClockSkew
+    } else if clockSkew < 0 {
+        clockSkew = 0
+    }
+    vendorIds := make(map[string]bool)
+    for _, vendorId := range config.VendorIds {
+        vendorIds[vendorId] = true
+    }
+    clientCertSubjects := make(map[string]bool)
+    for _, subject := range config.ClientCertSubjects {
+        clientCertSubjects[subject] = true
+    }
+    replayMethods := make(map[string]bool)
+    for _, method := range config.ReplayProtectedMethods {
+        replayMethods[method] = true
+    }
+    return &authService{
+        issuer: config.Issuer,
+        vendorIds: vendorIds,
+        devMode: config.DevMode,
+        keyFile: config.KeyFile,
+        keyReloadInterval: reloadInterval,
+        policy: tokenPolicy{
+            audiences: config.Audiences,
+            clockSkew: clockSkew,
+            maxTokenAge: config.MaxTokenAge,
+            authorizedParty: config.AuthorizedParty,
+        },
+        replayCache: config.ReplayCache,
+        replayMethods: replayMethods,
+        clientCertMode: config.ClientCertMode,
+        clientCertSubjects: clientCertSubjects,
+        clientCertScopes: config.ClientCertScopes,
+    }
 }
@@ -0,0 +1,177 @@
+package auth
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+// Start a mock issuer and an auth service verifying its tokens through discovery.
+func startTestAuth(t *testing.T, config Config) (*issuer.Issuer, *authService) {
+    i, server, err := issuer.StartTestIssuer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(server.Close)
+
+    config.Issuer = i.URL()
+    config.VendorIds = []string{testVendorId}
+    auth := NewAuthService(config)
+    if err := auth.Initialize(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { auth.Shutdown(context.Background()) })
+    if !auth.Ready() {
+        t.Fatal("auth not ready after discovery")
+    }
+    return i, auth
+}
+
+func mint(t *testing.T, i *issuer.Issuer, claims issuer.TokenClaims) string {
+    token, err := i.Mint(claims)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return token
+}
+
+// Pass a JSON-RPC call for method through the middleware, returning the claims it read.
+func callClaims(auth *authService, token string, method string) *Claims {
+    body := `{"jsonrpc":"2.0","id":1,"method":"SubscriptionService.` + method + `","params":[{}]}`
+    request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+    request.Header.Set("Authorization", token)
+    var claims *Claims
+    auth.Middleware(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        claims = request.Context().Value("claims").(*Claims)
+    })).ServeHTTP(httptest.NewRecorder(), request)
+    return claims
+}
+
+func errorCode(err error) json2.ErrorCode {
+    if rpcErr, ok := err.(*json2.Error); ok {
+        return rpcErr.Code
+    }
+    return 0
+}
+
+func TestTokenPolicy(t *testing.T) {
+    i, auth := startTestAuth(t, Config{
+        Audiences: []string{"subscribed"},
+        MaxTokenAge: 2 * time.Hour,
+        AuthorizedParty: "platform",
+    })
+    now := time.Now()
+
+    tests := []struct {
+        name string
+        claims func(claims *issuer.TokenClaims)
+        code json2.ErrorCode
+    }{
+        {"valid", func(claims *issuer.TokenClaims) {}, 0},
+        {"expired", func(claims *issuer.TokenClaims) {
+            claims.IssuedAt = now.Add(-time.Hour)
+            claims.Lifetime = 30 * time.Minute
+        }, errors.CodeTokenExpired},
+        {"expired within skew", func(claims *issuer.TokenClaims) {
+            claims.IssuedAt = now.Add(-time.Hour)
+            claims.Lifetime = time.Hour - time.Minute
+        }, 0},
+        {"issued in the future", func(claims *issuer.TokenClaims) {
+            claims.IssuedAt = now.Add(time.Hour)
+        }, errors.CodeTokenNotYetValid},
+        {"issuer clock ahead within skew", func(claims *issuer.TokenClaims) {
+            claims.IssuedAt = now.Add(time.Minute)
+        }, 0},
+        {"not yet valid", func(claims *issuer.TokenClaims) {
+            claims.Extra["nbf"] = now.Add(time.Hour).Unix()
+        }, errors.CodeTokenNotYetValid},
+        {"too old", func(claims *issuer.TokenClaims) {
+            claims.IssuedAt = now.Add(-3 * time.Hour)
+            claims.Lifetime = 4 * time.Hour
+        }, errors.CodeTokenTooOld},
+        {"wrong audience", func(claims *issuer.TokenClaims) {
+            claims.Audience = []string{"other"}
+        }, errors.CodeInvalidAudience},
+        {"wrong authorized party", func(claims *issuer.TokenClaims) {
+            claims.Extra["azp"] = "other"
+        }, errors.CodeInvalidAuthorizedParty},
+        {"wrong vendor", func(claims *issuer.TokenClaims) {
+            claims.VendorId = "vendor-2"
+        }, errors.CodeInvalidVendorIdClaim},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            claims := issuer.TokenClaims{
+                VendorId: testVendorId,
+                Audience: []string{"subscribed"},
+                Extra: map[string]interface{}{"azp": "platform"},
+            }
+            test.claims(&claims)
+            result := callClaims(auth, mint(t, i, claims), "HealthCheck")
+            if code := errorCode(result.Error); code != test.code {
+                t.Fatalf("expected code %d, got %d (%v)", test.code, code, result.Error)
+            }
+        })
+    }
+}
+
+func TestInvalidTokens(t *testing.T) {
+    _, auth := startTestAuth(t, Config{})
+    other, server, err := issuer.StartTestIssuer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer server.Close()
+
+    if code := errorCode(callClaims(auth, "", "HealthCheck").Error); code != errors.CodeUnauthenticated {
+        t.Errorf("missing token: expected code %d, got %d", errors.CodeUnauthenticated, code)
+    }
+    if code := errorCode(callClaims(auth, "not-a-jwt", "HealthCheck").Error); code != errors.CodeJwtError {
+        t.Errorf("malformed token: expected code %d, got %d", errors.CodeJwtError, code)
+    }
+    foreign := mint(t, other, issuer.TokenClaims{VendorId: testVendorId})
+    if code := errorCode(callClaims(auth, foreign, "HealthCheck").Error); code != errors.CodeJwtError {
+        t.Errorf("token from another issuer: expected code %d, got %d", errors.CodeJwtError, code)
+    }
+}
+
+func TestClaims(t *testing.T) {
+    i, auth := startTestAuth(t, Config{})
+    token := mint(t, i, issuer.TokenClaims{
+        VendorId: testVendorId,
+        AccountId: "acct-1",
+        Scopes: []string{"provision:read", "usage:read"},
+    })
+    claims := callClaims(auth, token, "HealthCheck")
+    if claims.Error != nil {
+        t.Fatal(claims.Error)
+    }
+    if claims.VendorId != testVendorId || claims.AccountId != "acct-1" {
+        t.Errorf("unexpected identity: %s/%s", claims.VendorId, claims.AccountId)
+    }
+    if !claims.HasScope("usage:read") || claims.HasScope("provision:write") {
+        t.Errorf("unexpected scopes: %v", claims.Scopes)
+    }
+    if claims.TokenId == "" || claims.Expiry.IsZero() {
+        t.Error("expected jti and expiry")
+    }
+}
+
+func TestClockSkewDisabled(t *testing.T) {
+    i, auth := startTestAuth(t, Config{ClockSkew: -1})
+    token := mint(t, i, issuer.TokenClaims{
+        VendorId: testVendorId,
+        IssuedAt: time.Now().Add(-time.Hour),
+        Lifetime: time.Hour - time.Minute,
+    })
+    if code := errorCode(callClaims(auth, token, "HealthCheck").Error); code != errors.CodeTokenExpired {
+        t.Fatalf("expected code %d without skew, got %d", errors.CodeTokenExpired, code)
+    }
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+    "time"
+
+    "github.com/coreos/go-oidc/v3/oidc"
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+// Default leeway for clocks out of sync with the issuer, matching the leeway
+// go-oidc applies to nbf.
+const DefaultClockSkew = 5 * time.Minute
+
+// Checks on verified tokens beyond signature and issuer.
+type tokenPolicy struct {
+    // Accepted audiences. A token must name at least one; empty accepts any audience.
+    audiences []string
+    // Leeway applied to exp, nbf and iat, for clocks out of sync with the issuer.
+    clockSkew time.Duration
+    // Maximum time since iat. Zero disables the check.
+    maxTokenAge time.Duration
+    // Required azp claim. Empty disables the check.
+    authorizedParty string
+}
+
+// Registered claims not exposed by oidc.IDToken.
+type registeredClaims struct {
+    NotBefore float64 `json:"nbf"`
+    AuthorizedParty string `json:"azp"`
+}
+
+// Build a verifier checking signature and issuer. Expiry is left to tokenPolicy,
+// which applies the configured clock skew.
+func (auth *authService) newVerifier(keySet oidc.KeySet, algorithms []string) *oidc.IDTokenVerifier {
+    // No client ID, as we are not executing a full OIDC handshake.
+    return oidc.NewVerifier(auth.issuer, keySet, &oidc.Config{
+        SkipClientIDCheck: true,
+        SkipExpiryCheck: true,
+        SupportedSigningAlgs: algorithms,
+    })
+}
+
+func (policy *tokenPolicy) check(token *oidc.IDToken, now time.Time) error {
+    var registered registeredClaims
+    if err := token.Claims(&registered); err != nil {
+        return errors.JwtError(err)
+    }
+
+    if now.After(token.Expiry.Add(policy.clockSkew)) {
+        return errors.TokenExpired()
+    }
+    if registered.NotBefore != 0 && now.Add(policy.clockSkew).Before(time.Unix(int64(registered.NotBefore), 0)) {
+        return errors.TokenNotYetValid()
+    }
+    if !token.IssuedAt.IsZero() && now.Add(policy.clockSkew).Before(token.IssuedAt) {
+        return errors.TokenNotYetValid()
+    }
+    if policy.maxTokenAge > 0 {
+        // A token without iat has no provable age.
+        if token.IssuedAt.IsZero() || now.Sub(token.IssuedAt) > policy.maxTokenAge + policy.clockSkew {
+            return errors.TokenTooOld()
+        }
+    }
+
+    if len(policy.audiences) > 0 && !containsAny(token.Audience, policy.audiences) {
+        log.Warn("Token audience not accepted", "audience", token.Audience)
+        return errors.InvalidAudience()
+    }
+    if policy.authorizedParty != "" && registered.AuthorizedParty != policy.authorizedParty {
+        log.Warn("Token authorized party not accepted", "azp", registered.AuthorizedParty)
+        return errors.InvalidAuthorizedParty()
+    }
+    return nil
+}
+
+func containsAny(values []string, accepted []string) bool {
+    for _, value := range values {
+        for _, candidate := range accepted {
+            if value == candidate {
+                return true
+            }
+        }
+    }
+    return false
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+    "bytes"
+    "container/heap"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+// Retention of token IDs from tokens without an exp claim, e.g. development tokens.
+const defaultReplayRetention = time.Hour
+
+// Records token IDs (jti claims) seen on protected calls, with a fingerprint of
+// the request each was first used for. Implement this over a shared store to
+// reject replays across several server instances.
+type ReplayCache interface {
+    // Record tokenId and fingerprint until expiry, reporting whether tokenId was
+    // already recorded with a different fingerprint. A repeat of the recorded
+    // fingerprint is a retry of the same request, and is not reported.
+    // Must be atomic with respect to concurrent calls for the same tokenId.
+    Seen(ctx context.Context, tokenId string, fingerprint string, expiry time.Time) (bool, error)
+}
+
+// An in-memory ReplayCache holding at most capacity token IDs. Expired IDs are
+// dropped first; when the cache is full of live IDs, the soonest to expire is evicted.
+type memoryReplayCache struct {
+    capacity int
+    mutex sync.Mutex
+    entries map[string]replayEntry
+    queue replayQueue
+}
+
+type replayEntry struct {
+    tokenId string
+    fingerprint string
+    expiry time.Time
+}
+
+// Min-heap of entries by expiry.
+type replayQueue []replayEntry
+
+func (q replayQueue) Len() int { return len(q) }
+func (q replayQueue) Less(i, j int) bool { return q[i].expiry.Before(q[j].expiry) }
+func (q replayQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *replayQueue) Push(x interface{}) { *q = append(*q, x.(replayEntry)) }
+func (q *replayQueue) Pop() interface{} {
+    old := *q
+    entry := old[len(old) - 1]
+    *q = old[:len(old) - 1]
+    return entry
+}
+
+func (c *memoryReplayCache) Seen(ctx context.Context, tokenId string, fingerprint string, expiry time.Time) (bool, error) {
+    now := time.Now()
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if seen, ok := c.entries[tokenId]; ok && seen.expiry.After(now) {
+        return seen.fingerprint != fingerprint, nil
+    }
+    for c.queue.Len() > 0 && (!c.queue[0].expiry.After(now) || c.queue.Len() >= c.capacity) {
+        entry := heap.Pop(&c.queue).(replayEntry)
+        if entry.expiry.After(now) {
+            log.Warn("Replay cache full, evicting unexpired token ID", "capacity", c.capacity)
+        }
+        // Skip stale entries for an ID since recorded again.
+        if c.entries[entry.tokenId] == entry {
+            delete(c.entries, entry.tokenId)
+        }
+    }
+    entry := replayEntry{tokenId: tokenId, fingerprint: fingerprint, expiry: expiry}
+    c.entries[tokenId] = entry
+    heap.Push(&c.queue, entry)
+    return false, nil
+}
+
+// Create an in-memory ReplayCache holding up to capacity token IDs.
+func NewMemoryReplayCache(capacity int) ReplayCache {
+    if capacity <= 0 {
+        capacity = 1
+    }
+    return &memoryReplayCache{
+        capacity: capacity,
+        entries: make(map[string]replayEntry),
+    }
+}
+
+// Read the RPC method name, e.g. "TerminateResource", and a fingerprint of the
+// method and parameters from a JSON-RPC request body, leaving the body intact
+// for the RPC server. The request ID is not part of the fingerprint, so a retry
+// sending the same parameters has the same fingerprint.
+func peekRpcRequest(request *http.Request) (method string, fingerprint string) {
+    if request.Body == nil {
+        return "", ""
+    }
+    body, err := io.ReadAll(request.Body)
+    request.Body.Close()
+    request.Body = io.NopCloser(bytes.NewReader(body))
+    if err != nil {
+        return "", ""
+    }
+    var envelope struct {
+        Method string `json:"method"`
+        Params json.RawMessage `json:"params"`
+    }
+    if json.Unmarshal(body, &envelope) != nil {
+        return "", ""
+    }
+    var params bytes.Buffer
+    if json.Compact(&params, envelope.Params) != nil {
+        params.Write(envelope.Params)
+    }
+    hash := sha256.New()
+    hash.Write([]byte(envelope.Method + "\n"))
+    hash.Write(params.Bytes())
+    // Methods are registered as "Service.Method".
+    method = envelope.Method[strings.LastIndex(envelope.Method, ".") + 1:]
+    return method, hex.EncodeToString(hash.Sum(nil))
+}
+
+// Reject reuse of a token's jti on a replay-protected method for a different
+// request. A retry of the same request is let through, for the service's
+// idempotency checks to replay the recorded reply.
+func (auth *authService) checkReplay(request *http.Request, claims *Claims) {
+    method, fingerprint := peekRpcRequest(request)
+    if !auth.replayMethods[method] {
+        return
+    }
+    if claims.certificateOnly {
+        return
+    }
+    if claims.TokenId == "" {
+        claims.Error = errors.MissingTokenId()
+        return
+    }
+    expiry := claims.Expiry
+    if expiry.IsZero() {
+        expiry = time.Now().Add(defaultReplayRetention)
+    }
+    // The token remains acceptable until expiry plus the allowed skew.
+    seen, err := auth.replayCache.Seen(request.Context(), claims.TokenId, fingerprint, expiry.Add(auth.policy.clockSkew))
+    if err != nil {
+        log.Error("Replay cache failure", "error", err)
+        claims.Error = errors.AuthNotReady()
+        return
+    }
+    if seen {
+        log.Warn("Rejected replayed token", "method", method, "jti", claims.TokenId)
+        claims.Error = errors.TokenReplayed()
+    }
+}
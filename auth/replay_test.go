@@ -0,0 +1,105 @@
+package auth
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+func seen(t *testing.T, cache ReplayCache, tokenId string, fingerprint string, expiry time.Time) bool {
+    result, err := cache.Seen(context.Background(), tokenId, fingerprint, expiry)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return result
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+    cache := NewMemoryReplayCache(10)
+    expiry := time.Now().Add(time.Hour)
+    if seen(t, cache, "a", "request-1", expiry) {
+        t.Fatal("first use reported as seen")
+    }
+    if seen(t, cache, "a", "request-1", expiry) {
+        t.Fatal("retry of the same request reported as seen")
+    }
+    if !seen(t, cache, "a", "request-2", expiry) {
+        t.Fatal("reuse for another request not detected")
+    }
+    if seen(t, cache, "b", "request-2", expiry) {
+        t.Fatal("distinct token reported as seen")
+    }
+}
+
+func TestMemoryReplayCacheEviction(t *testing.T) {
+    cache := NewMemoryReplayCache(2)
+    now := time.Now()
+    seen(t, cache, "a", "request-1", now.Add(time.Hour))
+    seen(t, cache, "b", "request-1", now.Add(2 * time.Hour))
+    // Full: the soonest to expire is evicted.
+    seen(t, cache, "c", "request-1", now.Add(3 * time.Hour))
+    if !seen(t, cache, "c", "request-2", now.Add(3 * time.Hour)) {
+        t.Fatal("newest token evicted")
+    }
+    if seen(t, cache, "a", "request-2", now.Add(time.Hour)) {
+        t.Fatal("soonest to expire was not evicted")
+    }
+}
+
+func TestMemoryReplayCacheExpiry(t *testing.T) {
+    cache := NewMemoryReplayCache(10)
+    seen(t, cache, "a", "request-1", time.Now().Add(-time.Second))
+    if seen(t, cache, "a", "request-2", time.Now().Add(time.Hour)) {
+        t.Fatal("expired token ID still reported as seen")
+    }
+}
+
+// Pass a JSON-RPC request body through the middleware, returning the claims it read.
+func callBody(auth *authService, token string, body string) *Claims {
+    request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+    request.Header.Set("Authorization", token)
+    var claims *Claims
+    auth.Middleware(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        claims = request.Context().Value("claims").(*Claims)
+    })).ServeHTTP(httptest.NewRecorder(), request)
+    return claims
+}
+
+func TestReplayProtection(t *testing.T) {
+    i, auth := startTestAuth(t, Config{
+        ReplayCache: NewMemoryReplayCache(100),
+        ReplayProtectedMethods: []string{"CreateSubscription"},
+    })
+    token := mint(t, i, issuer.TokenClaims{VendorId: testVendorId})
+
+    create := `{"jsonrpc":"2.0","id":1,"method":"SubscriptionService.CreateSubscription","params":[{"subscriptionId":"sub-1"}]}`
+    if err := callBody(auth, token, create).Error; err != nil {
+        t.Fatalf("first use rejected: %v", err)
+    }
+    // A retry of the same request, with a new request ID and spacing, is let through.
+    retry := `{"jsonrpc": "2.0", "id": 2, "method": "SubscriptionService.CreateSubscription", "params": [{"subscriptionId": "sub-1"}]}`
+    if err := callBody(auth, token, retry).Error; err != nil {
+        t.Fatalf("retry rejected: %v", err)
+    }
+    other := `{"jsonrpc":"2.0","id":3,"method":"SubscriptionService.CreateSubscription","params":[{"subscriptionId":"sub-2"}]}`
+    if code := errorCode(callBody(auth, token, other).Error); code != errors.CodeTokenReplayed {
+        t.Fatalf("expected code %d on reuse, got %d", errors.CodeTokenReplayed, code)
+    }
+    // Unprotected methods accept the token repeatedly.
+    for n := 0; n < 2; n++ {
+        if err := callClaims(auth, token, "HealthCheck").Error; err != nil {
+            t.Fatalf("unprotected method rejected: %v", err)
+        }
+    }
+
+    noId := mint(t, i, issuer.TokenClaims{VendorId: testVendorId, Extra: map[string]interface{}{"jti": ""}})
+    if code := errorCode(callClaims(auth, noId, "CreateSubscription").Error); code != errors.CodeMissingTokenId {
+        t.Fatalf("expected code %d without jti, got %d", errors.CodeMissingTokenId, code)
+    }
+}
@@ -0,0 +1,112 @@
+// Package catalog declares the SKUs offered by a vendor.
+package catalog
+
+import (
+    "encoding/json"
+    "os"
+    "sort"
+    "sync"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/logger"
+    "github.com/jupitercloud/subscribed/schema"
+)
+
+var log = logger.Named("catalog");
+
+type Catalog struct {
+    mutex sync.RWMutex
+    skus map[int64]api.CatalogSku
+    // Compiled configuration schemas, for SKUs which declare one.
+    schemas *schema.Registry
+}
+
+// Declare a SKU, replacing any previous declaration and its schema. The
+// configuration schema, if any, is compiled on registration.
+func (c *Catalog) Register(sku api.CatalogSku) error {
+    if len(sku.ConfigurationSchema) > 0 {
+        if err := c.schemas.Register(sku.Sku, sku.ConfigurationSchema); err != nil {
+            return err
+        }
+    } else {
+        c.schemas.Remove(sku.Sku)
+    }
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.skus[sku.Sku] = sku
+    log.Debug("Registered SKU", "sku", sku.Sku, "name", sku.Name)
+    return nil
+}
+
+// Fetch a declared SKU.
+func (c *Catalog) Lookup(sku int64) (*api.CatalogSku, bool) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    entry, ok := c.skus[sku]
+    if !ok {
+        return nil, false
+    }
+    return &entry, true
+}
+
+// List all declared SKUs, ordered by SKU.
+func (c *Catalog) Skus() []api.CatalogSku {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    skus := make([]api.CatalogSku, 0, len(c.skus))
+    for _, sku := range c.skus {
+        skus = append(skus, sku)
+    }
+    sort.Slice(skus, func(i, j int) bool { return skus[i].Sku < skus[j].Sku })
+    return skus
+}
+
+// Verify a SKU is declared.
+func (c *Catalog) Verify(sku int64) *json2.Error {
+    if _, ok := c.Lookup(sku); !ok {
+        return errors.UnsupportedSkuError(sku)
+    }
+    return nil
+}
+
+// Verify a SKU is declared, and validate a resource configuration against its
+// schema. SKUs without a schema accept any configuration.
+func (c *Catalog) Validate(sku int64, configuration json.RawMessage) *json2.Error {
+    if err := c.Verify(sku); err != nil {
+        return err
+    }
+    if !c.schemas.Has(sku) {
+        return nil
+    }
+    return c.schemas.Validate(sku, configuration)
+}
+
+func NewCatalog() *Catalog {
+    return &Catalog{
+        skus: make(map[int64]api.CatalogSku),
+        schemas: schema.NewRegistry(),
+    }
+}
+
+// Load a catalog from a JSON file holding an array of SKUs.
+func LoadFile(path string) (*Catalog, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var skus []api.CatalogSku
+    if err := json.Unmarshal(data, &skus); err != nil {
+        return nil, err
+    }
+    c := NewCatalog()
+    for _, sku := range skus {
+        if err := c.Register(sku); err != nil {
+            return nil, err
+        }
+    }
+    log.Info("Loaded catalog", "path", path, "skus", len(skus))
+    return c, nil
+}
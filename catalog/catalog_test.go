@@ -0,0 +1,77 @@
+package catalog
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+func TestValidate(t *testing.T) {
+    c := NewCatalog()
+    skus := []api.CatalogSku{
+        {Sku: 2, Name: "Large", ConfigurationSchema: json.RawMessage(`{"type": "object", "required": ["region"]}`)},
+        {Sku: 1, Name: "Small"},
+    }
+    for _, sku := range skus {
+        if err := c.Register(sku); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    if listed := c.Skus(); len(listed) != 2 || listed[0].Sku != 1 || listed[1].Sku != 2 {
+        t.Fatalf("unexpected SKU listing: %+v", listed)
+    }
+    if err := c.Validate(1, json.RawMessage(`"anything"`)); err != nil {
+        t.Errorf("SKU without a schema rejected configuration: %v", err)
+    }
+    if err := c.Validate(2, json.RawMessage(`{"region": "eu"}`)); err != nil {
+        t.Errorf("valid configuration rejected: %v", err)
+    }
+    if err := c.Validate(2, json.RawMessage(`{}`)); err == nil || err.Code != errors.CodeInvalidArgument {
+        t.Errorf("expected an invalid argument error, got %v", err)
+    }
+    if err := c.Validate(3, nil); err == nil || err.Code != errors.CodeUnsupportedSku {
+        t.Errorf("expected an unsupported SKU error, got %v", err)
+    }
+
+    // Re-registering without a schema drops the previous schema.
+    if err := c.Register(api.CatalogSku{Sku: 2, Name: "Large"}); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Validate(2, json.RawMessage(`{}`)); err != nil {
+        t.Errorf("dropped schema still applied: %v", err)
+    }
+}
+
+func TestRegisterInvalidSchema(t *testing.T) {
+    c := NewCatalog()
+    if err := c.Register(api.CatalogSku{Sku: 1, ConfigurationSchema: json.RawMessage(`{"type": 5}`)}); err == nil {
+        t.Fatal("expected an invalid schema to be rejected")
+    }
+    if _, ok := c.Lookup(1); ok {
+        t.Fatal("SKU with an invalid schema was registered")
+    }
+}
+
+func TestLoadFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "catalog.json")
+    data := `[{"sku": 1, "name": "Small", "usageUnits": ["hours"]}, {"sku": 2, "name": "Large"}]`
+    if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+        t.Fatal(err)
+    }
+    c, err := LoadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sku, ok := c.Lookup(1)
+    if !ok || sku.Name != "Small" || len(sku.UsageUnits) != 1 {
+        t.Fatalf("unexpected SKU: %+v", sku)
+    }
+    if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+        t.Fatal("expected an error for a missing file")
+    }
+}
@@ -0,0 +1,119 @@
+// Package client calls a subscribed JSON-RPC server with typed requests.
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("client")
+
+// Service name under which the server registers its methods.
+const serviceName = "SubscriptionService"
+
+type Client struct {
+    // RPC endpoint URL, e.g. "http://localhost:8081/rpc"
+    url string
+    // Authorization header value
+    token string
+    httpClient *http.Client
+}
+
+// Set the Authorization header sent with every call. Either a signed JWT, or
+// the raw JSON claims accepted by a server in development mode (see DevToken).
+func (c *Client) SetToken(token string) {
+    c.token = token
+}
+
+// Use a custom HTTP client, e.g. for TLS configuration or timeouts.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+    c.httpClient = httpClient
+}
+
+// Build the raw JSON claims accepted as a token by a server in development mode.
+// An empty accountId yields a vendor-wide token.
+func DevToken(vendorId string, accountId string, scopes ...string) string {
+    claims := map[string]interface{}{
+        "https://jupitercloud.com/vendorId": vendorId,
+    }
+    if accountId != "" {
+        claims["https://jupitercloud.com/accountId"] = accountId
+    }
+    if len(scopes) > 0 {
+        claims["scope"] = strings.Join(scopes, " ")
+    }
+    token, _ := json.Marshal(claims)
+    return string(token)
+}
+
+// Invoke a method by name, e.g. "CreateSubscription". Errors returned by the
+// server are decoded to *json2.Error; see the errors package for codes.
+func (c *Client) Call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+    ctx, span := tracer.Start(ctx, "RPC " + method, trace.WithSpanKind(trace.SpanKindClient))
+    defer span.End()
+    span.SetAttributes(
+        attribute.String("rpc.system", "json_rpc"),
+        attribute.String("rpc.method", method),
+    )
+
+    err := c.call(ctx, method, args, reply)
+    if err != nil {
+        span.SetStatus(codes.Error, err.Error())
+    } else {
+        span.SetStatus(codes.Ok, codes.Ok.String())
+    }
+    return err
+}
+
+func (c *Client) call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+    body, err := json2.EncodeClientRequest(serviceName + "." + method, args)
+    if err != nil {
+        return err
+    }
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Content-Type", "application/json")
+    if c.token != "" {
+        request.Header.Set("Authorization", c.token)
+    }
+    otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+    response, err := c.httpClient.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+
+    data, err := io.ReadAll(response.Body)
+    if err != nil {
+        return err
+    }
+    err = json2.DecodeClientResponse(bytes.NewReader(data), reply)
+    if rpcErr, ok := err.(*json2.Error); ok {
+        return decodeError(rpcErr)
+    }
+    if err != nil && response.StatusCode != http.StatusOK {
+        // Transport-level failures are reported as plain text.
+        return fmt.Errorf("rpc: HTTP %d: %s", response.StatusCode, bytes.TrimSpace(data))
+    }
+    return err
+}
+
+// Create a client for the RPC endpoint at url, e.g. "http://localhost:8081/rpc".
+func NewClient(url string) *Client {
+    return &Client{url: url, httpClient: http.DefaultClient}
+}
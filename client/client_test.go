@@ -0,0 +1,103 @@
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+// Encode an error as a server's JSON-RPC response, and decode it as the client does.
+func roundTrip(t *testing.T, sent *json2.Error) error {
+    t.Helper()
+    response, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "error": sent})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var reply struct{}
+    err = json2.DecodeClientResponse(bytes.NewReader(response), &reply)
+    rpcErr, ok := err.(*json2.Error)
+    if !ok {
+        t.Fatalf("expected a JSON-RPC error, got %v", err)
+    }
+    return decodeError(rpcErr)
+}
+
+func TestDecodeError(t *testing.T) {
+    sent := []*json2.Error{
+        errors.Unauthenticated(),
+        errors.JwtError(fmt.Errorf("signature invalid")),
+        errors.InvalidArgumentError("/configuration/size: required"),
+        errors.UnsupportedSkuError(42),
+        errors.AccountScopeError("acct-1"),
+        errors.ConflictError("sub-1", "subscription is terminated"),
+        errors.OperationNotFoundError("op-1"),
+        errors.ForbiddenError("CreateResource", "provision:write"),
+        errors.TokenReplayed(),
+        errors.ClientCertificateRequired(),
+    }
+    for _, expected := range sent {
+        t.Run(expected.Message, func(t *testing.T) {
+            decoded, ok := roundTrip(t, expected).(*json2.Error)
+            if !ok {
+                t.Fatalf("expected *json2.Error")
+            }
+            if decoded.Code != expected.Code || decoded.Message != expected.Message {
+                t.Fatalf("decoded %d %q, expected %d %q", decoded.Code, decoded.Message, expected.Code, expected.Message)
+            }
+            if !errors.HasCode(decoded, expected.Code) {
+                t.Fatalf("HasCode failed for %d", expected.Code)
+            }
+        })
+    }
+
+    // Unknown codes are returned as decoded.
+    unknown := roundTrip(t, &json2.Error{Code: json2.E_NO_METHOD, Message: "rpc: can't find method"})
+    if rpcErr, ok := unknown.(*json2.Error); !ok || rpcErr.Code != json2.E_NO_METHOD {
+        t.Fatalf("unexpected error %v", unknown)
+    }
+}
+
+func TestCall(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        if request.Header.Get("Authorization") != "token" {
+            http.Error(response, "no token", http.StatusUnauthorized)
+            return
+        }
+        var body struct {
+            Method string `json:"method"`
+            Id interface{} `json:"id"`
+        }
+        json.NewDecoder(request.Body).Decode(&body)
+        reply := map[string]interface{}{"jsonrpc": "2.0", "id": body.Id}
+        if body.Method == "SubscriptionService.HealthCheck" {
+            reply["result"] = api.HealthCheckResponse{}
+        } else {
+            reply["error"] = errors.UnsupportedSkuError(7)
+        }
+        json.NewEncoder(response).Encode(reply)
+    }))
+    defer server.Close()
+    ctx := context.Background()
+
+    c := NewClient(server.URL)
+    if _, err := c.HealthCheck(ctx, &api.HealthCheckRequest{}); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+        t.Fatalf("expected an HTTP error, got %v", err)
+    }
+    c.SetToken("token")
+    if _, err := c.HealthCheck(ctx, &api.HealthCheckRequest{}); err != nil {
+        t.Fatal(err)
+    }
+    _, err := c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{Sku: 7})
+    if !errors.HasCode(err, errors.CodeUnsupportedSku) {
+        t.Fatalf("expected an unsupported SKU error, got %v", err)
+    }
+}
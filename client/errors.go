@@ -0,0 +1,76 @@
+package client
+
+import (
+    "strings"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+func dataString(err *json2.Error, key string) string {
+    data, _ := err.Data.(map[string]interface{})
+    value, _ := data[key].(string)
+    return value
+}
+
+func dataInt(err *json2.Error, key string) int64 {
+    data, _ := err.Data.(map[string]interface{})
+    value, _ := data[key].(float64)
+    return int64(value)
+}
+
+// Rebuild a server error with the matching errors package constructor, so
+// callers see the same values the server returned. Unknown codes, such as the
+// json2 protocol errors, are returned as decoded.
+func decodeError(err *json2.Error) *json2.Error {
+    var decoded *json2.Error
+    switch err.Code {
+    case errors.CodeUnauthenticated:
+        decoded = errors.Unauthenticated()
+    case errors.CodeInvalidVendorIdClaim:
+        decoded = errors.InvalidVendorIdClaim()
+    case errors.CodeJwtError:
+        decoded = errors.JwtError(stringError(dataString(err, "details")))
+    case errors.CodeInvalidArgument:
+        decoded = errors.InvalidArgumentError(strings.TrimPrefix(err.Message, "Invalid argument: "))
+    case errors.CodeUnsupportedSku:
+        decoded = errors.UnsupportedSkuError(dataInt(err, "sku"))
+    case errors.CodeAccountScope:
+        decoded = errors.AccountScopeError(dataString(err, "accountId"))
+    case errors.CodeConflict:
+        decoded = errors.ConflictError(dataString(err, "id"), strings.TrimPrefix(err.Message, "Conflicting request: "))
+    case errors.CodeOperationNotFound:
+        decoded = errors.OperationNotFoundError(dataString(err, "operationId"))
+    case errors.CodeAuthNotReady:
+        decoded = errors.AuthNotReady()
+    case errors.CodeForbidden:
+        decoded = errors.ForbiddenError(dataString(err, "method"), dataString(err, "scope"))
+    case errors.CodeTokenExpired:
+        decoded = errors.TokenExpired()
+    case errors.CodeTokenNotYetValid:
+        decoded = errors.TokenNotYetValid()
+    case errors.CodeTokenTooOld:
+        decoded = errors.TokenTooOld()
+    case errors.CodeInvalidAudience:
+        decoded = errors.InvalidAudience()
+    case errors.CodeInvalidAuthorizedParty:
+        decoded = errors.InvalidAuthorizedParty()
+    case errors.CodeTokenReplayed:
+        decoded = errors.TokenReplayed()
+    case errors.CodeMissingTokenId:
+        decoded = errors.MissingTokenId()
+    case errors.CodeClientCertificateRequired:
+        decoded = errors.ClientCertificateRequired()
+    default:
+        return err
+    }
+    // Keep any additional detail the server attached.
+    if err.Data != nil {
+        decoded.Data = err.Data
+    }
+    return decoded
+}
+
+type stringError string
+
+func (e stringError) Error() string { return string(e) }
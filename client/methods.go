@@ -0,0 +1,168 @@
+package client
+
+import (
+    "context"
+
+    "github.com/jupitercloud/subscribed/api"
+)
+
+// Probe the service for liveness.
+func (c *Client) HealthCheck(ctx context.Context, args *api.HealthCheckRequest) (*api.HealthCheckResponse, error) {
+    var reply api.HealthCheckResponse
+    if err := c.Call(ctx, "HealthCheck", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Create (or reopen) a customer account.
+func (c *Client) OpenAccount(ctx context.Context, args *api.OpenAccountRequest) (*api.OpenAccountResponse, error) {
+    var reply api.OpenAccountResponse
+    if err := c.Call(ctx, "OpenAccount", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Close a customer account.
+func (c *Client) CloseAccount(ctx context.Context, args *api.CloseAccountRequest) (*api.CloseAccountResponse, error) {
+    var reply api.CloseAccountResponse
+    if err := c.Call(ctx, "CloseAccount", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Create a new subscription.
+func (c *Client) CreateSubscription(ctx context.Context, args *api.CreateSubscriptionRequest) (*api.CreateSubscriptionResponse, error) {
+    var reply api.CreateSubscriptionResponse
+    if err := c.Call(ctx, "CreateSubscription", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Change the SKU of an existing subscription.
+func (c *Client) UpdateSubscription(ctx context.Context, args *api.UpdateSubscriptionRequest) (*api.UpdateSubscriptionResponse, error) {
+    var reply api.UpdateSubscriptionResponse
+    if err := c.Call(ctx, "UpdateSubscription", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Lock out access to a subscription while preserving its data, e.g. for a billing hold.
+func (c *Client) SuspendSubscription(ctx context.Context, args *api.SuspendSubscriptionRequest) (*api.SuspendSubscriptionResponse, error) {
+    var reply api.SuspendSubscriptionResponse
+    if err := c.Call(ctx, "SuspendSubscription", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Restore access to a suspended subscription.
+func (c *Client) ResumeSubscription(ctx context.Context, args *api.ResumeSubscriptionRequest) (*api.ResumeSubscriptionResponse, error) {
+    var reply api.ResumeSubscriptionResponse
+    if err := c.Call(ctx, "ResumeSubscription", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Terminate an existing subscription.
+func (c *Client) TerminateSubscription(ctx context.Context, args *api.TerminateSubscriptionRequest) (*api.TerminateSubscriptionResponse, error) {
+    var reply api.TerminateSubscriptionResponse
+    if err := c.Call(ctx, "TerminateSubscription", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Create a new resource in a subscription.
+func (c *Client) CreateResource(ctx context.Context, args *api.CreateResourceRequest) (*api.CreateResourceResponse, error) {
+    var reply api.CreateResourceResponse
+    if err := c.Call(ctx, "CreateResource", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Reconfigure or rename a resource in a subscription.
+func (c *Client) UpdateResource(ctx context.Context, args *api.UpdateResourceRequest) (*api.UpdateResourceResponse, error) {
+    var reply api.UpdateResourceResponse
+    if err := c.Call(ctx, "UpdateResource", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Terminate a resource in a subscription.
+func (c *Client) TerminateResource(ctx context.Context, args *api.TerminateResourceRequest) (*api.TerminateResourceResponse, error) {
+    var reply api.TerminateResourceResponse
+    if err := c.Call(ctx, "TerminateResource", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Query billable usage for a subscription
+func (c *Client) GetSubscriptionUsage(ctx context.Context, args *api.GetSubscriptionUsageRequest) (*api.GetSubscriptionUsageResponse, error) {
+    var reply api.GetSubscriptionUsageResponse
+    if err := c.Call(ctx, "GetSubscriptionUsage", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Fetch the status of an asynchronous operation.
+func (c *Client) GetOperationStatus(ctx context.Context, args *api.GetOperationStatusRequest) (*api.GetOperationStatusResponse, error) {
+    var reply api.GetOperationStatusResponse
+    if err := c.Call(ctx, "GetOperationStatus", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Fetch the SKU catalog.
+func (c *Client) GetCatalog(ctx context.Context, args *api.GetCatalogRequest) (*api.GetCatalogResponse, error) {
+    var reply api.GetCatalogResponse
+    if err := c.Call(ctx, "GetCatalog", args, &reply); err != nil {
+        return nil, err
+    }
+    return &reply, nil
+}
+
+// Allocate the typed request and reply for a method, by name.
+func NewMethodArgs(method string) (args interface{}, reply interface{}, ok bool) {
+    switch method {
+    case "HealthCheck":
+        return &api.HealthCheckRequest{}, &api.HealthCheckResponse{}, true
+    case "OpenAccount":
+        return &api.OpenAccountRequest{}, &api.OpenAccountResponse{}, true
+    case "CloseAccount":
+        return &api.CloseAccountRequest{}, &api.CloseAccountResponse{}, true
+    case "CreateSubscription":
+        return &api.CreateSubscriptionRequest{}, &api.CreateSubscriptionResponse{}, true
+    case "UpdateSubscription":
+        return &api.UpdateSubscriptionRequest{}, &api.UpdateSubscriptionResponse{}, true
+    case "SuspendSubscription":
+        return &api.SuspendSubscriptionRequest{}, &api.SuspendSubscriptionResponse{}, true
+    case "ResumeSubscription":
+        return &api.ResumeSubscriptionRequest{}, &api.ResumeSubscriptionResponse{}, true
+    case "TerminateSubscription":
+        return &api.TerminateSubscriptionRequest{}, &api.TerminateSubscriptionResponse{}, true
+    case "CreateResource":
+        return &api.CreateResourceRequest{}, &api.CreateResourceResponse{}, true
+    case "UpdateResource":
+        return &api.UpdateResourceRequest{}, &api.UpdateResourceResponse{}, true
+    case "TerminateResource":
+        return &api.TerminateResourceRequest{}, &api.TerminateResourceResponse{}, true
+    case "GetSubscriptionUsage":
+        return &api.GetSubscriptionUsageRequest{}, &api.GetSubscriptionUsageResponse{}, true
+    case "GetOperationStatus":
+        return &api.GetOperationStatusRequest{}, &api.GetOperationStatusResponse{}, true
+    case "GetCatalog":
+        return &api.GetCatalogRequest{}, &api.GetCatalogResponse{}, true
+    }
+    return nil, nil, false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/jupitercloud/subscribed/audit"
+)
+
+type AuditCmd struct {
+    Verify AuditVerifyCmd `cmd:"" help:"Verify the hash chain of an audit log"`
+    List AuditListCmd `cmd:"" help:"Print audit records matching filters, as JSON Lines"`
+}
+
+type AuditVerifyCmd struct {
+    File string `arg:"" type:"existingfile" help:"Audit log file"`
+    KeyFile string `required:"" type:"existingfile" help:"Secret key file the server keyed the hash chain with"`
+    ExpectHead string `help:"Head hash recorded by the server, e.g. logged on shutdown. Fails if the log ends elsewhere, detecting truncation"`
+}
+
+func (cmd *AuditVerifyCmd) Run() error {
+    key, err := audit.ReadKeyFile(cmd.KeyFile)
+    if err != nil {
+        return err
+    }
+    file, err := os.Open(cmd.File)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    count, head, err := audit.Verify(file, key)
+    if err != nil {
+        return fmt.Errorf("%s: verification failed after %d records: %w", cmd.File, count, err)
+    }
+    if cmd.ExpectHead != "" && head != cmd.ExpectHead {
+        return fmt.Errorf("%s: head %q after %d records, expected %q: records missing", cmd.File, head, count, cmd.ExpectHead)
+    }
+    fmt.Printf("%s: %d records verified, head %s\n", cmd.File, count, head)
+    return nil
+}
+
+type AuditListCmd struct {
+    File string `arg:"" type:"existingfile" help:"Audit log file"`
+    Method string `help:"Only records of this RPC method"`
+    VendorId string `help:"Only records for this vendor ID"`
+    AccountId string `help:"Only records acting on this account ID"`
+    SubscriptionId string `help:"Only records acting on this subscription ID"`
+    ResourceId string `help:"Only records acting on this resource ID"`
+    Subject string `help:"Only records from this token subject"`
+    Errors bool `help:"Only failed or rejected calls"`
+    Since time.Time `help:"Only records at or after this RFC 3339 time"`
+    Until time.Time `help:"Only records before this RFC 3339 time"`
+}
+
+func (cmd *AuditListCmd) matches(record audit.Record) bool {
+    return (cmd.Method == "" || record.Method == cmd.Method) &&
+        (cmd.VendorId == "" || record.VendorId == cmd.VendorId) &&
+        (cmd.AccountId == "" || record.AccountId == cmd.AccountId) &&
+        (cmd.SubscriptionId == "" || record.SubscriptionId == cmd.SubscriptionId) &&
+        (cmd.ResourceId == "" || record.ResourceId == cmd.ResourceId) &&
+        (cmd.Subject == "" || record.Subject == cmd.Subject) &&
+        (!cmd.Errors || record.Outcome != audit.OutcomeSuccess) &&
+        (cmd.Since.IsZero() || !record.Time.Before(cmd.Since)) &&
+        (cmd.Until.IsZero() || record.Time.Before(cmd.Until))
+}
+
+func (cmd *AuditListCmd) Run() error {
+    file, err := os.Open(cmd.File)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    encoder := json.NewEncoder(os.Stdout)
+    return audit.Read(file, func(record audit.Record) error {
+        if !cmd.matches(record) {
+            return nil
+        }
+        return encoder.Encode(record)
+    })
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "reflect"
+    "strings"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/client"
+)
+
+type CallCmd struct {
+    Method string `arg:"" help:"RPC method, e.g. CreateSubscription"`
+    Params string `arg:"" optional:"" help:"JSON request parameters, or '-' to read them from stdin"`
+    Set map[string]string `short:"s" placeholder:"FIELD=VALUE" help:"Set a request parameter. String fields take the value as given; other values are decoded as JSON. May be repeated"`
+    Address string `default:"http://localhost:8081/rpc" help:"Server RPC URL"`
+    Token string `env:"SUBSCRIBED_TOKEN" help:"Authorization token"`
+    VendorId string `help:"Mint an unsigned development mode token for this vendor ID, when no token is given. Only servers run with --dev accept it"`
+    AccountId string `help:"Account ID scope of a minted token"`
+    Scope []string `help:"Scopes granted to a minted token. May be repeated"`
+    TlsCa string `help:"CA certificate file verifying the server certificate"`
+    TlsCert string `help:"Client certificate file, for a server requiring mutual TLS"`
+    TlsKey string `help:"Client private key file"`
+}
+
+// Build an HTTP client trusting the configured CA and presenting the client certificate.
+func (cmd *CallCmd) httpClient() (*http.Client, error) {
+    tlsConfig := &tls.Config{}
+    if cmd.TlsCa != "" {
+        data, err := os.ReadFile(cmd.TlsCa)
+        if err != nil {
+            return nil, err
+        }
+        tlsConfig.RootCAs = x509.NewCertPool()
+        if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+            return nil, fmt.Errorf("%s: no certificates found", cmd.TlsCa)
+        }
+    }
+    if cmd.TlsCert != "" {
+        cert, err := tls.LoadX509KeyPair(cmd.TlsCert, cmd.TlsKey)
+        if err != nil {
+            return nil, err
+        }
+        tlsConfig.Certificates = []tls.Certificate{cert}
+    }
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.TLSClientConfig = tlsConfig
+    return &http.Client{Transport: transport}, nil
+}
+
+// Merge the JSON parameters and --set flags into the typed request for the method.
+func (cmd *CallCmd) buildArgs(args interface{}) error {
+    params := map[string]interface{}{}
+    raw := []byte(cmd.Params)
+    if cmd.Params == "-" {
+        var err error
+        if raw, err = io.ReadAll(os.Stdin); err != nil {
+            return err
+        }
+    }
+    if len(bytes.TrimSpace(raw)) > 0 {
+        if err := json.Unmarshal(raw, &params); err != nil {
+            return fmt.Errorf("invalid params: %w", err)
+        }
+    }
+    for field, value := range cmd.Set {
+        var decoded interface{}
+        if isStringField(args, field) {
+            params[field] = value
+        } else if json.Unmarshal([]byte(value), &decoded) == nil {
+            params[field] = decoded
+        } else {
+            params[field] = value
+        }
+    }
+
+    // Round-trip through the typed request to reject misspelled fields.
+    encoded, err := json.Marshal(params)
+    if err != nil {
+        return err
+    }
+    decoder := json.NewDecoder(bytes.NewReader(encoded))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(args); err != nil {
+        return fmt.Errorf("invalid params for %s: %w", cmd.Method, err)
+    }
+    return nil
+}
+
+// Report whether the request field with the JSON name is a string, so a --set
+// value such as "12345" is sent as given rather than decoded as a number.
+func isStringField(args interface{}, name string) bool {
+    t := reflect.TypeOf(args)
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    if t.Kind() != reflect.Struct {
+        return false
+    }
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        tag := strings.Split(field.Tag.Get("json"), ",")[0]
+        if tag == name || (tag == "" && strings.EqualFold(field.Name, name)) {
+            return field.Type.Kind() == reflect.String
+        }
+    }
+    return false
+}
+
+func (cmd *CallCmd) Run() error {
+    args, reply, ok := client.NewMethodArgs(cmd.Method)
+    if !ok {
+        return fmt.Errorf("unknown method: %s", cmd.Method)
+    }
+    if err := cmd.buildArgs(args); err != nil {
+        return err
+    }
+
+    c := client.NewClient(cmd.Address)
+    if cmd.TlsCa != "" || cmd.TlsCert != "" {
+        httpClient, err := cmd.httpClient()
+        if err != nil {
+            return err
+        }
+        c.SetHTTPClient(httpClient)
+    }
+    if cmd.Token != "" {
+        c.SetToken(cmd.Token)
+    } else if cmd.VendorId != "" {
+        c.SetToken(client.DevToken(cmd.VendorId, cmd.AccountId, cmd.Scope...))
+    }
+
+    log.Debug("Calling", "address", cmd.Address, "method", cmd.Method)
+    err := c.Call(context.Background(), cmd.Method, args, reply)
+    if rpcErr, ok := err.(*json2.Error); ok {
+        printJson(map[string]interface{}{"error": rpcErr})
+        return fmt.Errorf("%s failed with code %d", cmd.Method, rpcErr.Code)
+    }
+    if err != nil {
+        return err
+    }
+    printJson(reply)
+    return nil
+}
+
+func printJson(value interface{}) {
+    encoded, err := json.MarshalIndent(value, "", "  ")
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return
+    }
+    fmt.Println(string(encoded))
+}
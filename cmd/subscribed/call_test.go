@@ -0,0 +1,44 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+
+    "github.com/jupitercloud/subscribed/api"
+)
+
+func TestBuildArgs(t *testing.T) {
+    cmd := &CallCmd{
+        Method: "CreateResource",
+        Params: `{"accountId": "acct-1", "sku": 1}`,
+        Set: map[string]string{
+            // String fields keep numeric-looking values as strings.
+            "resourceId": "12345",
+            "sku": "3",
+            "configuration": `{"size": "large"}`,
+            "resourceName": "not json",
+        },
+    }
+    args := &api.CreateResourceRequest{}
+    if err := cmd.buildArgs(args); err != nil {
+        t.Fatal(err)
+    }
+    if args.AccountId != "acct-1" || args.ResourceId != "12345" || args.Sku != 3 || args.ResourceName != "not json" {
+        t.Fatalf("unexpected request: %+v", args)
+    }
+    var configuration map[string]string
+    if err := json.Unmarshal(args.Configuration, &configuration); err != nil || configuration["size"] != "large" {
+        t.Fatalf("unexpected configuration %s", args.Configuration)
+    }
+}
+
+func TestBuildArgsRejectsUnknownFields(t *testing.T) {
+    cmd := &CallCmd{Method: "CreateSubscription", Set: map[string]string{"acountId": "acct-1"}}
+    if err := cmd.buildArgs(&api.CreateSubscriptionRequest{}); err == nil {
+        t.Fatal("expected a misspelled field to be rejected")
+    }
+    cmd = &CallCmd{Method: "CreateSubscription", Params: `{"accountId": `}
+    if err := cmd.buildArgs(&api.CreateSubscriptionRequest{}); err == nil {
+        t.Fatal("expected malformed params to be rejected")
+    }
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "os"
+
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+type IssuerCmd struct {
+    Address string `default:":8089" help:"Issuer bind address"`
+    Url string `help:"Public issuer URL. Defaults to http://localhost followed by the bind address"`
+    Key string `help:"PEM signing key file, generated when missing. A fresh key is used for every run when unset"`
+}
+
+func (cmd *IssuerCmd) Run(quit chan os.Signal) error {
+    url := cmd.Url
+    if url == "" {
+        url = "http://localhost" + cmd.Address
+    }
+
+    var mock *issuer.Issuer
+    var err error
+    if cmd.Key != "" {
+        mock, err = issuer.NewIssuerWithKeyFile(url, cmd.Key)
+    } else {
+        mock, err = issuer.NewIssuer(url)
+    }
+    if err != nil {
+        return err
+    }
+
+    server := &http.Server{Addr: cmd.Address, Handler: mock.Handler()}
+
+    go func() {
+        <-quit
+        server.Shutdown(context.Background())
+    }()
+
+    log.Warn("Launching mock OIDC issuer. Do not use in production", "address", cmd.Address, "issuer", url)
+    err = server.ListenAndServe()
+    if err != nil && err != http.ErrServerClosed {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+    "os"
+    "os/signal"
+    "strings"
+    "syscall"
+
+    "github.com/jupitercloud/subscribed/logger"
+)
+
+func (globals *Globals) configureLogging() error {
+    levels := globals.LogLevels
+    if globals.LogLevelsFile != "" {
+        data, err := os.ReadFile(globals.LogLevelsFile)
+        if err != nil {
+            return err
+        }
+        levels = strings.Join([]string{levels, strings.TrimSpace(string(data))}, ",")
+    }
+    return logger.Configure(logger.Config{
+        Level: globals.LogLevel,
+        Levels: levels,
+        JSONFormat: globals.LogFormat == "json",
+        File: globals.LogFile,
+        MaxSize: globals.LogMaxSize,
+        MaxBackups: globals.LogMaxBackups,
+    })
+}
+
+// On SIGHUP, re-read the levels file and reopen the log file.
+func (globals *Globals) reloadLoggingOnHangup() {
+    hangup := make(chan os.Signal, 1)
+    signal.Notify(hangup, syscall.SIGHUP)
+    for range hangup {
+        if globals.LogLevelsFile != "" {
+            data, err := os.ReadFile(globals.LogLevelsFile)
+            if err == nil {
+                err = logger.SetLevels(strings.Join([]string{globals.LogLevel, globals.LogLevels, strings.TrimSpace(string(data))}, ","))
+            }
+            if err != nil {
+                log.Error("Failed to reload log levels", "path", globals.LogLevelsFile, "error", err)
+            } else {
+                log.Info("Reloaded log levels", "levels", logger.Levels())
+            }
+        }
+        if err := logger.Reopen(); err != nil {
+            log.Error("Failed to reopen log file", "error", err)
+        }
+    }
+}
@@ -2,46 +2,168 @@ package main
 
 import (
     "context"
+    "fmt"
     "os"
     "os/signal"
+    "strings"
     "syscall"
+    "time"
 
     "github.com/alecthomas/kong"
+    "github.com/jupitercloud/subscribed/audit"
+    "github.com/jupitercloud/subscribed/auth"
+    "github.com/jupitercloud/subscribed/catalog"
     "github.com/jupitercloud/subscribed/logger"
+    "github.com/jupitercloud/subscribed/redact"
+    "github.com/jupitercloud/subscribed/schema"
     "github.com/jupitercloud/subscribed/service"
+    "github.com/jupitercloud/subscribed/store"
     "github.com/jupitercloud/subscribed/telemetry"
 )
 
 var log = logger.Named("main");
 
 type Globals struct {
-    LogLevel string `enum:"debug,info,warn,error" default:"info"`
-    Telemetry string `enum:"console,grpc,none" default:"none"`
+    LogLevel string `enum:"trace,debug,info,warn,error,off" default:"info"`
+    LogLevels string `help:"Per-subsystem log levels overriding --log-level, e.g. auth=debug,service=info"`
+    LogLevelsFile string `help:"File holding per-subsystem log levels, re-read on SIGHUP"`
+    LogFormat string `enum:"text,json" default:"text" help:"Log output format"`
+    LogFile string `help:"Write logs to this file instead of stderr. Reopened on SIGHUP"`
+    LogMaxSize int64 `default:"104857600" help:"Size in bytes at which the log file is rotated. Zero disables rotation"`
+    LogMaxBackups int `default:"5" help:"Rotated log files kept"`
+    MetadataAllow []string `help:"Vendor metadata key shown in logs and traces. All other keys are masked. May be repeated"`
+    MetadataDeny []string `help:"Vendor metadata key masked in logs and traces. Without --metadata-allow, all other keys are shown. May be repeated"`
+    Telemetry string `enum:"console,grpc,prometheus,none" default:"none" help:"Telemetry export mode. prometheus serves metrics at /metrics on the admin address, and requires --admin-address"`
 }
 
 type ServerCmd struct {
     Address string `default:":8081" help:"Server bind address"`
     Issuer string `default:"https://jupitercloud.com" help:"OIDC compatible token issuer URL"`
-    VendorId string `required:"" help:"Vendor ID operated by this server"`
+    VendorId []string `required:"" help:"Vendor ID operated by this server. Repeat to host several vendors, each with its own stub"`
     Dev bool `default:"false" help:"Development mode. Authorization is disabled"`
+    KeyFile string `help:"JWKS or PEM public key file verifying tokens, instead of OIDC discovery from the issuer"`
+    KeyReloadInterval time.Duration `default:"1m" help:"Interval between checks of the key file for rotated keys"`
+    Audience []string `help:"Accepted token audience. May be repeated"`
+    ClockSkew time.Duration `default:"5m" help:"Allowed clock skew when checking token expiry and issue time. Negative checks without leeway"`
+    MaxTokenAge time.Duration `default:"0s" help:"Maximum time since a token was issued. Zero accepts any age"`
+    AuthorizedParty string `help:"Required azp claim of tokens"`
+    TlsCert string `help:"TLS certificate file. Serves HTTPS when set"`
+    TlsKey string `help:"TLS private key file"`
+    TlsReloadInterval time.Duration `default:"1m" help:"Interval between checks of the TLS files for a renewed certificate"`
+    ClientCa string `help:"CA certificate file verifying client certificates. Enables mutual TLS"`
+    ClientCertMode string `enum:"and-token,or-token" default:"and-token" help:"Whether a client certificate is required with a token (and-token), or accepted instead of one (or-token)"`
+    ClientCertSubject []string `help:"Client certificate common name, DNS or URI SAN accepted without a token in or-token mode. May be repeated"`
+    ClientCertScope []string `help:"Scope granted to callers authenticated by client certificate alone. May be repeated"`
+    AdminAddress string `help:"Serve admin endpoints, e.g. GET/PUT /log-levels, on this address. Keep it private, e.g. localhost:8082"`
+    AdminTokenFile string `help:"File holding a bearer token required by admin endpoints. Required unless --admin-address is a loopback address"`
+    AuditLog string `help:"Append a hash-chained JSON Lines audit record of every RPC to this file"`
+    AuditKeyFile string `help:"Secret key file, of at least 32 bytes, keying the audit log hash chain. Required with --audit-log"`
+    Store string `help:"Entitlement store database file. Defaults to a non-persistent in-memory store"`
+    Schema map[int64]string `placeholder:"SKU=FILE" help:"JSON Schema file validating resource configuration for a SKU. May be repeated"`
+    Catalog string `help:"SKU catalog JSON file, published through GetCatalog"`
+    ReplayCacheSize int `default:"0" help:"Reject reuse of a token ID for a different request on mutating methods, remembering up to this many IDs. Zero disables replay protection"`
+    EnforceScopes bool `help:"Require token scopes for each method, per service.DefaultScopePolicy"`
 }
 
 type CLI struct {
     Globals
     Server ServerCmd `cmd:"" help:"Run a server"`
+    Call CallCmd `cmd:"" help:"Invoke an RPC method on a running server"`
+    Issuer IssuerCmd `cmd:"" help:"Run a mock OIDC issuer minting test tokens"`
+    Audit AuditCmd `cmd:"" help:"Inspect an audit log"`
 }
 
 func (cmd *ServerCmd) Run (quit chan os.Signal) error {
     config := service.ServerConfig{
         Address: cmd.Address,
         Issuer: cmd.Issuer,
-        VendorId: cmd.VendorId,
+        VendorId: cmd.VendorId[0],
         Dev: cmd.Dev,
+        KeyFile: cmd.KeyFile,
+        KeyReloadInterval: cmd.KeyReloadInterval,
+        Audiences: cmd.Audience,
+        ClockSkew: cmd.ClockSkew,
+        MaxTokenAge: cmd.MaxTokenAge,
+        AuthorizedParty: cmd.AuthorizedParty,
+        TLSCertFile: cmd.TlsCert,
+        TLSKeyFile: cmd.TlsKey,
+        TLSReloadInterval: cmd.TlsReloadInterval,
+        ClientCAFile: cmd.ClientCa,
+        ClientCertMode: cmd.ClientCertMode,
+        ClientCertSubjects: cmd.ClientCertSubject,
+        ClientCertScopes: cmd.ClientCertScope,
+        AdminAddress: cmd.AdminAddress,
+        MetricsHandler: telemetry.MetricsHandler(),
+    }
+    if cmd.AdminTokenFile != "" {
+        token, err := os.ReadFile(cmd.AdminTokenFile)
+        if err != nil {
+            return err
+        }
+        config.AdminToken = strings.TrimSpace(string(token))
+    }
+    if cmd.ReplayCacheSize > 0 {
+        config.ReplayCache = auth.NewMemoryReplayCache(cmd.ReplayCacheSize)
+    }
+    if cmd.EnforceScopes {
+        config.ScopePolicy = service.DefaultScopePolicy
+    }
+    if cmd.AuditLog != "" {
+        if cmd.AuditKeyFile == "" {
+            return fmt.Errorf("--audit-log requires --audit-key-file")
+        }
+        key, err := audit.ReadKeyFile(cmd.AuditKeyFile)
+        if err != nil {
+            return err
+        }
+        config.AuditLog = audit.NewLog(cmd.AuditLog, key)
+    }
+    config.Store = cmd.createStore("")
+    if cmd.Catalog != "" {
+        skus, err := catalog.LoadFile(cmd.Catalog)
+        if err != nil {
+            return err
+        }
+        config.Catalog = skus
+    }
+    if len(cmd.Schema) > 0 {
+        config.Schemas = schema.NewRegistry()
+        for sku, path := range cmd.Schema {
+            if err := config.Schemas.RegisterFile(sku, path); err != nil {
+                return err
+            }
+        }
+    }
+    if len(cmd.VendorId) > 1 {
+        vendors := make(map[string]service.Vendor)
+        for _, vendorId := range cmd.VendorId {
+            vendors[vendorId] = service.Vendor{
+                Impl: service.CreateSubscriptionServiceStub(),
+                Store: cmd.createStore(vendorId),
+                Schemas: config.Schemas,
+                Catalog: config.Catalog,
+            }
+        }
+        return service.RunMultiVendorServer(config, vendors, quit)
     }
     impl := service.CreateSubscriptionServiceStub()
     return service.RunServer(config, impl, quit)
 }
 
+// Create the entitlement store, if configured; otherwise the server falls back
+// to an in-memory store. Each hosted vendor gets its own database file,
+// suffixed with the vendor ID.
+func (cmd *ServerCmd) createStore(vendorId string) store.Store {
+    if cmd.Store == "memory" {
+        return store.NewMemoryStore()
+    } else if cmd.Store != "" && vendorId != "" {
+        return store.NewBoltStore(cmd.Store + "." + vendorId)
+    } else if cmd.Store != "" {
+        return store.NewBoltStore(cmd.Store)
+    }
+    return nil
+}
+
 func main() {
     // This program uses Kong to parse the CLI
     // See https://danielms.site/zet/2023/kong-is-an-amazing-cli-for-go-apps/
@@ -54,13 +176,18 @@ func main() {
     ctx := kong.Parse(&cli)
 
     // Initialize logging
-    logger.Initialize(cli.Globals.LogLevel)
+    ctx.FatalIfErrorf(cli.Globals.configureLogging())
+    go cli.Globals.reloadLoggingOnHangup()
+    redact.Configure(redact.Policy{
+        AllowMetadataKeys: cli.Globals.MetadataAllow,
+        DenyMetadataKeys: cli.Globals.MetadataDeny,
+    })
 
    	// Set up OpenTelemetry.
   	shutdownTelemetry, err := telemetry.Initialize(context.Background(), telemetry.ExportModeFromString(cli.Globals.Telemetry))
 
     if err == nil {
-        quit := make(chan os.Signal)
+        quit := make(chan os.Signal, 1)
         signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
         // Run the Server
         err = ctx.Run(quit)
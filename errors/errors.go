@@ -4,23 +4,51 @@ import (
 	"github.com/gorilla/rpc/v2/json2"
 )
 
+// Application error codes, in the JSON-RPC implementation-defined range.
+const (
+    CodeUnauthenticated json2.ErrorCode = -1001
+    CodeInvalidVendorIdClaim json2.ErrorCode = -1002
+    CodeJwtError json2.ErrorCode = -1003
+    CodeInvalidArgument json2.ErrorCode = -1004
+    CodeUnsupportedSku json2.ErrorCode = -1005
+    CodeAccountScope json2.ErrorCode = -1006
+    CodeConflict json2.ErrorCode = -1007
+    CodeOperationNotFound json2.ErrorCode = -1008
+    CodeAuthNotReady json2.ErrorCode = -1009
+    CodeForbidden json2.ErrorCode = -1010
+    CodeTokenExpired json2.ErrorCode = -1011
+    CodeTokenNotYetValid json2.ErrorCode = -1012
+    CodeTokenTooOld json2.ErrorCode = -1013
+    CodeInvalidAudience json2.ErrorCode = -1014
+    CodeInvalidAuthorizedParty json2.ErrorCode = -1015
+    CodeTokenReplayed json2.ErrorCode = -1016
+    CodeMissingTokenId json2.ErrorCode = -1017
+    CodeClientCertificateRequired json2.ErrorCode = -1018
+)
+
+// Report whether err is a json2 error with the given code.
+func HasCode(err error, code json2.ErrorCode) bool {
+    rpcErr, ok := err.(*json2.Error)
+    return ok && rpcErr.Code == code
+}
+
 func Unauthenticated() *json2.Error {
     return &json2.Error{
-        Code: -1001,
+        Code: CodeUnauthenticated,
         Message: "Authorization requred",
     }
 }
 
 func InvalidVendorIdClaim() *json2.Error {
     return &json2.Error{
-        Code: -1002,
+        Code: CodeInvalidVendorIdClaim,
         Message: "Invalid vendorId claim",
     }
 }
 
 func JwtError(cause error) *json2.Error {
     return &json2.Error{
-        Code: -1003,
+        Code: CodeJwtError,
         Message: "Invalid JWT",
         Data: map[string]interface{}{
             "details": cause.Error(),
@@ -30,17 +58,121 @@ func JwtError(cause error) *json2.Error {
 
 func InvalidArgumentError(reason string) *json2.Error {
   return &json2.Error{
-        Code: -1004,
+        Code: CodeInvalidArgument,
         Message: "Invalid argument: " + reason,
   }
 }
 
 func UnsupportedSkuError(sku int64) *json2.Error {
   return &json2.Error{
-        Code: -1005,
+        Code: CodeUnsupportedSku,
         Message: "Unsupported SKU",
         Data: map[string]interface{}{
             "sku": sku,
         },
   }
 }
+
+func AccountScopeError(accountId string) *json2.Error {
+  return &json2.Error{
+        Code: CodeAccountScope,
+        Message: "Account outside of token scope",
+        Data: map[string]interface{}{
+            "accountId": accountId,
+        },
+  }
+}
+
+func ConflictError(id string, reason string) *json2.Error {
+  return &json2.Error{
+        Code: CodeConflict,
+        Message: "Conflicting request: " + reason,
+        Data: map[string]interface{}{
+            "id": id,
+        },
+  }
+}
+
+func OperationNotFoundError(operationId string) *json2.Error {
+  return &json2.Error{
+        Code: CodeOperationNotFound,
+        Message: "Operation not found",
+        Data: map[string]interface{}{
+            "operationId": operationId,
+        },
+  }
+}
+
+func AuthNotReady() *json2.Error {
+  return &json2.Error{
+        Code: CodeAuthNotReady,
+        Message: "Authorization service not ready",
+  }
+}
+
+func ForbiddenError(method string, scope string) *json2.Error {
+  return &json2.Error{
+        Code: CodeForbidden,
+        Message: "Forbidden: " + method + " requires scope " + scope,
+        Data: map[string]interface{}{
+            "method": method,
+            "scope": scope,
+        },
+  }
+}
+
+func TokenExpired() *json2.Error {
+  return &json2.Error{
+        Code: CodeTokenExpired,
+        Message: "Token expired",
+  }
+}
+
+func TokenNotYetValid() *json2.Error {
+  return &json2.Error{
+        Code: CodeTokenNotYetValid,
+        Message: "Token not yet valid",
+  }
+}
+
+func TokenTooOld() *json2.Error {
+  return &json2.Error{
+        Code: CodeTokenTooOld,
+        Message: "Token exceeds maximum age",
+  }
+}
+
+func InvalidAudience() *json2.Error {
+  return &json2.Error{
+        Code: CodeInvalidAudience,
+        Message: "Invalid audience claim",
+  }
+}
+
+func InvalidAuthorizedParty() *json2.Error {
+  return &json2.Error{
+        Code: CodeInvalidAuthorizedParty,
+        Message: "Invalid azp claim",
+  }
+}
+
+func TokenReplayed() *json2.Error {
+  return &json2.Error{
+        Code: CodeTokenReplayed,
+        Message: "Token already used",
+  }
+}
+
+func MissingTokenId() *json2.Error {
+  return &json2.Error{
+        Code: CodeMissingTokenId,
+        Message: "Missing jti claim",
+  }
+}
+
+func ClientCertificateRequired() *json2.Error {
+  return &json2.Error{
+        Code: CodeClientCertificateRequired,
+        Message: "Client certificate required",
+  }
+}
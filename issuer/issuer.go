@@ -0,0 +1,248 @@
+// Package issuer provides a mock OIDC token issuer, for exercising real JWT
+// verification in tests without network access. It must not be used in production.
+package issuer
+
+import (
+    "crypto"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/json"
+    "encoding/pem"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/go-jose/go-jose/v3"
+    "github.com/go-jose/go-jose/v3/jwt"
+    "github.com/jupitercloud/subscribed/logger"
+)
+
+var log = logger.Named("issuer");
+
+const defaultTokenLifetime = time.Hour
+
+// Claims for a minted token. Zero-valued fields are omitted, except as noted.
+type TokenClaims struct {
+    // Token subject. Defaults to "subscribed-mock".
+    Subject string
+    // Jupiter Cloud vendor ID claim.
+    VendorId string
+    // Jupiter Cloud account ID claim. Empty for a vendor-wide token.
+    AccountId string
+    // Audience claim.
+    Audience []string
+    // Granted scopes, minted as a space-delimited scope claim.
+    Scopes []string
+    // Issue time. Defaults to now.
+    IssuedAt time.Time
+    // Token lifetime from IssuedAt. Defaults to one hour; negative values mint expired tokens.
+    Lifetime time.Duration
+    // Additional claims, e.g. "azp" or "jti". Overrides the claims above.
+    Extra map[string]interface{}
+}
+
+type Issuer struct {
+    url string
+    keyId string
+    key *rsa.PrivateKey
+    signer jose.Signer
+}
+
+// Public issuer URL, as it appears in the iss claim.
+func (i *Issuer) URL() string {
+    return i.url
+}
+
+func (i *Issuer) discovery() map[string]interface{} {
+    return map[string]interface{}{
+        "issuer": i.url,
+        "jwks_uri": i.url + "/jwks",
+        "authorization_endpoint": i.url + "/authorize",
+        "token_endpoint": i.url + "/token",
+        "response_types_supported": []string{"id_token"},
+        "subject_types_supported": []string{"public"},
+        "id_token_signing_alg_values_supported": []string{string(jose.RS256)},
+    }
+}
+
+// Public key set, as served at /jwks.
+func (i *Issuer) JWKS() jose.JSONWebKeySet {
+    return jose.JSONWebKeySet{
+        Keys: []jose.JSONWebKey{{
+            Key: &i.key.PublicKey,
+            KeyID: i.keyId,
+            Algorithm: string(jose.RS256),
+            Use: "sig",
+        }},
+    }
+}
+
+// Mint a signed JWT.
+func (i *Issuer) Mint(claims TokenClaims) (string, error) {
+    issuedAt := claims.IssuedAt
+    if issuedAt.IsZero() {
+        issuedAt = time.Now()
+    }
+    lifetime := claims.Lifetime
+    if lifetime == 0 {
+        lifetime = defaultTokenLifetime
+    }
+    subject := claims.Subject
+    if subject == "" {
+        subject = "subscribed-mock"
+    }
+
+    payload := map[string]interface{}{
+        "iss": i.url,
+        "sub": subject,
+        "iat": issuedAt.Unix(),
+        "exp": issuedAt.Add(lifetime).Unix(),
+        "jti": newTokenId(),
+    }
+    if len(claims.Audience) > 0 {
+        payload["aud"] = claims.Audience
+    }
+    if claims.VendorId != "" {
+        payload["https://jupitercloud.com/vendorId"] = claims.VendorId
+    }
+    if claims.AccountId != "" {
+        payload["https://jupitercloud.com/accountId"] = claims.AccountId
+    }
+    if len(claims.Scopes) > 0 {
+        payload["scope"] = strings.Join(claims.Scopes, " ")
+    }
+    for key, value := range claims.Extra {
+        payload[key] = value
+    }
+    return jwt.Signed(i.signer).Claims(payload).CompactSerialize()
+}
+
+// Serve the discovery document at /.well-known/openid-configuration, the key set
+// at /jwks, and minted tokens at /token. The token endpoint accepts query parameters
+// vendorId, accountId, aud (repeatable), scope (repeatable), azp, sub and ttl (a Go duration, e.g. "10m").
+func (i *Issuer) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(response http.ResponseWriter, request *http.Request) {
+        writeJson(response, i.discovery())
+    })
+    mux.HandleFunc("/jwks", func(response http.ResponseWriter, request *http.Request) {
+        writeJson(response, i.JWKS())
+    })
+    mux.HandleFunc("/token", func(response http.ResponseWriter, request *http.Request) {
+        query := request.URL.Query()
+        claims := TokenClaims{
+            Subject: query.Get("sub"),
+            VendorId: query.Get("vendorId"),
+            AccountId: query.Get("accountId"),
+            Audience: query["aud"],
+            Scopes: query["scope"],
+        }
+        if azp := query.Get("azp"); azp != "" {
+            claims.Extra = map[string]interface{}{"azp": azp}
+        }
+        if ttl := query.Get("ttl"); ttl != "" {
+            lifetime, err := time.ParseDuration(ttl)
+            if err != nil {
+                http.Error(response, err.Error(), http.StatusBadRequest)
+                return
+            }
+            claims.Lifetime = lifetime
+        }
+        token, err := i.Mint(claims)
+        if err != nil {
+            http.Error(response, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        writeJson(response, map[string]string{"id_token": token})
+    })
+    return mux
+}
+
+// Write the signing key to a PEM file, so tokens stay valid across restarts.
+func (i *Issuer) SaveKey(path string) error {
+    block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(i.key)}
+    return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+func writeJson(response http.ResponseWriter, value interface{}) {
+    response.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(response).Encode(value)
+}
+
+func newTokenId() string {
+    var buf [16]byte
+    if _, err := rand.Read(buf[:]); err != nil {
+        panic(err)
+    }
+    return hex.EncodeToString(buf[:])
+}
+
+func newIssuer(url string, key *rsa.PrivateKey) (*Issuer, error) {
+    // Derive the key ID from the key, so it is stable for a saved key.
+    thumbprint, err := (&jose.JSONWebKey{Key: &key.PublicKey}).Thumbprint(crypto.SHA256)
+    if err != nil {
+        return nil, err
+    }
+    keyId := hex.EncodeToString(thumbprint[:8])
+    options := (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyId)
+    signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, options)
+    if err != nil {
+        return nil, err
+    }
+    return &Issuer{url: strings.TrimSuffix(url, "/"), keyId: keyId, key: key, signer: signer}, nil
+}
+
+// Create an issuer for the public URL, with a freshly generated signing key.
+func NewIssuer(url string) (*Issuer, error) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return nil, err
+    }
+    return newIssuer(url, key)
+}
+
+// Create an issuer for the public URL, with the signing key in a PEM file.
+// The key is generated and saved when the file does not exist.
+func NewIssuerWithKeyFile(url string, path string) (*Issuer, error) {
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        i, err := NewIssuer(url)
+        if err != nil {
+            return nil, err
+        }
+        log.Info("Generated signing key", "path", path)
+        return i, i.SaveKey(path)
+    }
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, jose.ErrUnsupportedKeyType
+    }
+    key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+    if err != nil {
+        return nil, err
+    }
+    return newIssuer(url, key)
+}
+
+// Start an issuer on a local test server. Pass the returned issuer's URL as
+// ServerConfig.Issuer, and close the server when done.
+func StartTestIssuer() (*Issuer, *httptest.Server, error) {
+    var handler http.Handler
+    server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        handler.ServeHTTP(response, request)
+    }))
+    i, err := NewIssuer(server.URL)
+    if err != nil {
+        server.Close()
+        return nil, nil, err
+    }
+    handler = i.Handler()
+    return i, server, nil
+}
@@ -0,0 +1,151 @@
+package issuer
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/coreos/go-oidc/v3/oidc"
+)
+
+func fetchJson(t *testing.T, url string, value interface{}) {
+    t.Helper()
+    response, err := http.Get(url)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        t.Fatalf("GET %s: HTTP %d", url, response.StatusCode)
+    }
+    if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// Verify a token against the issuer's discovery document and key set.
+func verify(t *testing.T, i *Issuer, token string) map[string]interface{} {
+    t.Helper()
+    ctx := context.Background()
+    provider, err := oidc.NewProvider(ctx, i.URL())
+    if err != nil {
+        t.Fatal(err)
+    }
+    idToken, err := provider.Verifier(&oidc.Config{SkipClientIDCheck: true}).Verify(ctx, token)
+    if err != nil {
+        t.Fatal(err)
+    }
+    claims := map[string]interface{}{}
+    if err := idToken.Claims(&claims); err != nil {
+        t.Fatal(err)
+    }
+    return claims
+}
+
+func TestMint(t *testing.T) {
+    i, server, err := StartTestIssuer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer server.Close()
+
+    token, err := i.Mint(TokenClaims{
+        VendorId: "vendor-1",
+        AccountId: "acct-1",
+        Audience: []string{"subscribed"},
+        Scopes: []string{"provision:read", "usage:read"},
+        Extra: map[string]interface{}{"azp": "platform"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    claims := verify(t, i, token)
+    expected := map[string]string{
+        "iss": i.URL(),
+        "sub": "subscribed-mock",
+        "https://jupitercloud.com/vendorId": "vendor-1",
+        "https://jupitercloud.com/accountId": "acct-1",
+        "scope": "provision:read usage:read",
+        "azp": "platform",
+    }
+    for name, value := range expected {
+        if claims[name] != value {
+            t.Errorf("claim %s is %v, expected %q", name, claims[name], value)
+        }
+    }
+    if jti, _ := claims["jti"].(string); jti == "" {
+        t.Error("expected a jti claim")
+    }
+
+    // Negative lifetimes mint expired tokens.
+    expired, err := i.Mint(TokenClaims{Lifetime: -time.Minute})
+    if err != nil {
+        t.Fatal(err)
+    }
+    provider, err := oidc.NewProvider(context.Background(), i.URL())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := provider.Verifier(&oidc.Config{SkipClientIDCheck: true}).Verify(context.Background(), expired); err == nil {
+        t.Error("expected an expired token to fail verification")
+    }
+}
+
+func TestTokenEndpoint(t *testing.T) {
+    i, server, err := StartTestIssuer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer server.Close()
+
+    var discovery map[string]interface{}
+    fetchJson(t, i.URL() + "/.well-known/openid-configuration", &discovery)
+    if discovery["issuer"] != i.URL() || discovery["jwks_uri"] != i.URL() + "/jwks" {
+        t.Fatalf("unexpected discovery document: %v", discovery)
+    }
+
+    var reply struct {
+        IdToken string `json:"id_token"`
+    }
+    fetchJson(t, i.URL() + "/token?vendorId=vendor-1&scope=provision:read&scope=usage:read&sub=platform&ttl=10m", &reply)
+    claims := verify(t, i, reply.IdToken)
+    if claims["https://jupitercloud.com/vendorId"] != "vendor-1" || claims["sub"] != "platform" || claims["scope"] != "provision:read usage:read" {
+        t.Fatalf("unexpected claims: %v", claims)
+    }
+    if lifetime := claims["exp"].(float64) - claims["iat"].(float64); lifetime != 600 {
+        t.Errorf("lifetime %vs, expected 600s", lifetime)
+    }
+
+    response, err := http.Get(i.URL() + "/token?ttl=soon")
+    if err != nil {
+        t.Fatal(err)
+    }
+    response.Body.Close()
+    if response.StatusCode != http.StatusBadRequest {
+        t.Errorf("invalid ttl gave HTTP %d", response.StatusCode)
+    }
+}
+
+func TestKeyFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "issuer.pem")
+    first, err := NewIssuerWithKeyFile("http://localhost:8089/", path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if first.URL() != "http://localhost:8089" {
+        t.Errorf("URL %q keeps its trailing slash", first.URL())
+    }
+    second, err := NewIssuerWithKeyFile("http://localhost:8089", path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if first.JWKS().Keys[0].KeyID != second.JWKS().Keys[0].KeyID {
+        t.Fatal("reloaded key has a different key ID")
+    }
+    if !first.key.Equal(second.key) {
+        t.Fatal("reloaded key differs from the saved key")
+    }
+}
@@ -0,0 +1,32 @@
+package logger
+
+import (
+    "io"
+    "net/http"
+)
+
+// Serve the current level specification on GET, and replace it with the
+// request body on PUT or POST, e.g. "info,auth=debug".
+func LevelHandler() http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        switch request.Method {
+        case http.MethodGet:
+        case http.MethodPut, http.MethodPost:
+            body, err := io.ReadAll(io.LimitReader(request.Body, 4096))
+            if err != nil {
+                http.Error(response, err.Error(), http.StatusBadRequest)
+                return
+            }
+            if err := SetLevels(string(body)); err != nil {
+                http.Error(response, err.Error(), http.StatusBadRequest)
+                return
+            }
+            Named("logger").Info("Log levels changed", "levels", Levels())
+        default:
+            http.Error(response, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        response.Header().Set("Content-Type", "text/plain")
+        io.WriteString(response, Levels() + "\n")
+    })
+}
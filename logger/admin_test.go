@@ -0,0 +1,42 @@
+package logger
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestLevelHandler(t *testing.T) {
+    t.Cleanup(func() {
+        Configure(Config{Level: "debug"})
+    })
+    if err := Configure(Config{Level: "info"}); err != nil {
+        t.Fatal(err)
+    }
+    handler := LevelHandler()
+    serve := func(method string, body string) *httptest.ResponseRecorder {
+        response := httptest.NewRecorder()
+        handler.ServeHTTP(response, httptest.NewRequest(method, "/log-levels", strings.NewReader(body)))
+        return response
+    }
+
+    if response := serve(http.MethodGet, ""); response.Body.String() != "info\n" {
+        t.Errorf("GET returned %q", response.Body.String())
+    }
+    if response := serve(http.MethodPut, "warn,auth=debug"); response.Code != http.StatusOK || response.Body.String() != "warn,auth=debug\n" {
+        t.Errorf("PUT returned %d %q", response.Code, response.Body.String())
+    }
+    if !Named("auth").IsDebug() || Named("service").IsInfo() {
+        t.Error("levels not applied")
+    }
+    if response := serve(http.MethodPut, "auth=loud"); response.Code != http.StatusBadRequest {
+        t.Errorf("PUT of an unknown level returned %d", response.Code)
+    }
+    if response := serve(http.MethodDelete, ""); response.Code != http.StatusMethodNotAllowed {
+        t.Errorf("DELETE returned %d", response.Code)
+    }
+    if Levels() != "warn,auth=debug" {
+        t.Errorf("levels %q after rejected requests", Levels())
+    }
+}
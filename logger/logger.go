@@ -1,18 +1,238 @@
 package logger
 
 import (
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+
     "github.com/hashicorp/go-hclog"
 )
 
-var appLogger = hclog.New(&hclog.LoggerOptions{
-    Name: "subscribed",
-    Level: hclog.LevelFromString("DEBUG"),
-});
+type Config struct {
+    // Default level: trace, debug, info, warn, error or off.
+    Level string
+    // Per-subsystem levels overriding Level, e.g. "auth=debug,service=info".
+    // An entry without a subsystem sets the default level.
+    Levels string
+    // Emit JSON objects instead of text lines.
+    JSONFormat bool
+    // Optional log file, instead of stderr.
+    File string
+    // Size in bytes at which File is rotated. Zero disables rotation.
+    MaxSize int64
+    // Rotated files kept, as File.1 (newest) to File.N.
+    MaxBackups int
+}
+
+// Loggers are rebuilt from this state when the configuration changes, so
+// loggers returned by Named before configuration pick up the changes.
+var state = struct {
+    mutex sync.RWMutex
+    root hclog.Logger
+    defaultLevel hclog.Level
+    levels map[string]hclog.Level
+    loggers map[string]hclog.Logger
+    jsonFormat bool
+    output io.Writer
+    file *rotatingFile
+}{
+    defaultLevel: hclog.Debug,
+    levels: map[string]hclog.Level{},
+    loggers: map[string]hclog.Logger{},
+    output: os.Stderr,
+}
+
+func init() {
+    rebuild()
+}
+
+// Recreate the root logger. Caller holds the state lock, or is init.
+func rebuild() {
+    state.root = hclog.New(&hclog.LoggerOptions{
+        Name: "subscribed",
+        Level: state.defaultLevel,
+        JSONFormat: state.jsonFormat,
+        Output: state.output,
+        IndependentLevels: true,
+    })
+    state.loggers = map[string]hclog.Logger{}
+}
+
+// Parse a level name, rejecting unknown names rather than defaulting.
+func parseLevel(name string) (hclog.Level, error) {
+    level := hclog.LevelFromString(strings.TrimSpace(name))
+    if level == hclog.NoLevel {
+        return level, fmt.Errorf("unknown log level %q", name)
+    }
+    return level, nil
+}
+
+// Parse a level specification, e.g. "info,auth=debug".
+func parseLevels(spec string, defaultLevel hclog.Level) (hclog.Level, map[string]hclog.Level, error) {
+    levels := map[string]hclog.Level{}
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        name, levelName, found := strings.Cut(entry, "=")
+        if !found {
+            level, err := parseLevel(entry)
+            if err != nil {
+                return defaultLevel, nil, err
+            }
+            defaultLevel = level
+            continue
+        }
+        level, err := parseLevel(levelName)
+        if err != nil {
+            return defaultLevel, nil, err
+        }
+        levels[strings.ToLower(strings.TrimSpace(name))] = level
+    }
+    return defaultLevel, levels, nil
+}
+
+// Level for a subsystem, from the most specific matching entry. "auth" also
+// matches the nested subsystem "auth.keys".
+func levelFor(name string) hclog.Level {
+    name = strings.ToLower(name)
+    for {
+        if level, ok := state.levels[name]; ok {
+            return level
+        }
+        i := strings.LastIndex(name, ".")
+        if i < 0 {
+            return state.defaultLevel
+        }
+        name = name[:i]
+    }
+}
+
+// The current logger for a subsystem.
+func get(name string) hclog.Logger {
+    state.mutex.RLock()
+    l, ok := state.loggers[name]
+    state.mutex.RUnlock()
+    if ok {
+        return l
+    }
 
+    state.mutex.Lock()
+    defer state.mutex.Unlock()
+    if l, ok := state.loggers[name]; ok {
+        return l
+    }
+    l = state.root.Named(name)
+    l.SetLevel(levelFor(name))
+    state.loggers[name] = l
+    return l
+}
+
+// Set the default level.
 func Initialize(level string) {
-  appLogger.SetLevel(hclog.LevelFromString("DEBUG"))
+    parsed, err := parseLevel(level)
+    if err != nil {
+        parsed = hclog.Info
+    }
+    state.mutex.Lock()
+    defer state.mutex.Unlock()
+    state.defaultLevel = parsed
+    rebuild()
+}
+
+// Apply a full configuration, replacing any previous one.
+func Configure(config Config) error {
+    defaultLevel, err := parseLevel(config.Level)
+    if err != nil {
+        return err
+    }
+    defaultLevel, levels, err := parseLevels(config.Levels, defaultLevel)
+    if err != nil {
+        return err
+    }
+
+    var output io.Writer = os.Stderr
+    var file *rotatingFile
+    if config.File != "" {
+        file, err = openRotatingFile(config.File, config.MaxSize, config.MaxBackups)
+        if err != nil {
+            return err
+        }
+        output = file
+    }
+
+    state.mutex.Lock()
+    defer state.mutex.Unlock()
+    if state.file != nil {
+        state.file.Close()
+    }
+    state.defaultLevel = defaultLevel
+    state.levels = levels
+    state.jsonFormat = config.JSONFormat
+    state.output = output
+    state.file = file
+    rebuild()
+    return nil
+}
+
+// Change levels at runtime from a specification, e.g. "info,auth=debug".
+// Subsystems not named fall back to the default level.
+func SetLevels(spec string) error {
+    state.mutex.RLock()
+    defaultLevel := state.defaultLevel
+    state.mutex.RUnlock()
+    defaultLevel, levels, err := parseLevels(spec, defaultLevel)
+    if err != nil {
+        return err
+    }
+
+    state.mutex.Lock()
+    defer state.mutex.Unlock()
+    state.defaultLevel = defaultLevel
+    state.levels = levels
+    state.root.SetLevel(defaultLevel)
+    for name, l := range state.loggers {
+        l.SetLevel(levelFor(name))
+    }
+    return nil
+}
+
+// The current level specification, default level first.
+func Levels() string {
+    state.mutex.RLock()
+    defer state.mutex.RUnlock()
+    entries := []string{levelName(state.defaultLevel)}
+    var names []string
+    for name := range state.levels {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        entries = append(entries, name + "=" + levelName(state.levels[name]))
+    }
+    return strings.Join(entries, ",")
+}
+
+func levelName(level hclog.Level) string {
+    return strings.TrimSpace(strings.ToLower(level.String()))
+}
+
+// Reopen the log file, e.g. after it was moved by an external rotation tool.
+func Reopen() error {
+    state.mutex.RLock()
+    defer state.mutex.RUnlock()
+    if state.file == nil {
+        return nil
+    }
+    return state.file.Reopen()
 }
 
+// A logger for a subsystem, e.g. "auth". Levels and output follow the current
+// configuration, including changes made after this call.
 func Named(name string) hclog.Logger {
-    return appLogger.Named(name)
+    return &subsystemLogger{name: name}
 }
@@ -0,0 +1,130 @@
+package logger
+
+import (
+    "bufio"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// Configure JSON output to a file until the test ends, returning a function
+// reading the messages logged so far.
+func configureTestFile(t *testing.T, config Config) func() []map[string]interface{} {
+    config.JSONFormat = true
+    config.File = filepath.Join(t.TempDir(), "test.log")
+    if err := Configure(config); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        Configure(Config{Level: "debug"})
+    })
+    return func() []map[string]interface{} {
+        file, err := os.Open(config.File)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer file.Close()
+        var lines []map[string]interface{}
+        scanner := bufio.NewScanner(file)
+        for scanner.Scan() {
+            var line map[string]interface{}
+            if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+                t.Fatalf("log line %q is not JSON: %v", scanner.Text(), err)
+            }
+            lines = append(lines, line)
+        }
+        return lines
+    }
+}
+
+func messages(lines []map[string]interface{}) []string {
+    var result []string
+    for _, line := range lines {
+        result = append(result, line["@module"].(string) + ": " + line["@message"].(string))
+    }
+    return result
+}
+
+func expectMessages(t *testing.T, lines []map[string]interface{}, expected ...string) {
+    t.Helper()
+    got := messages(lines)
+    if len(got) != len(expected) {
+        t.Fatalf("logged %q, expected %q", got, expected)
+    }
+    for n := range expected {
+        if got[n] != expected[n] {
+            t.Fatalf("logged %q, expected %q", got, expected)
+        }
+    }
+}
+
+func TestSubsystemLevels(t *testing.T) {
+    // Loggers created before configuration follow it.
+    auth := Named("auth")
+    keys := Named("auth.keys")
+    service := Named("service")
+    read := configureTestFile(t, Config{Level: "warn", Levels: "auth=debug,auth.keys=error"})
+
+    auth.Debug("auth debug")
+    keys.Warn("keys warn")
+    keys.Error("keys error")
+    service.Info("service info")
+    service.Warn("service warn")
+    expectMessages(t, read(),
+        "subscribed.auth: auth debug",
+        "subscribed.auth.keys: keys error",
+        "subscribed.service: service warn")
+    if levels := Levels(); levels != "warn,auth=debug,auth.keys=error" {
+        t.Errorf("levels %q", levels)
+    }
+}
+
+func TestSetLevels(t *testing.T) {
+    auth := Named("auth")
+    service := Named("service")
+    read := configureTestFile(t, Config{Level: "info", Levels: "auth=error"})
+    auth.Info("before")
+
+    // Unnamed subsystems fall back to the default level.
+    if err := SetLevels("warn,service=debug"); err != nil {
+        t.Fatal(err)
+    }
+    auth.Info("auth info")
+    auth.Warn("auth warn")
+    service.Debug("service debug")
+    expectMessages(t, read(),
+        "subscribed.auth: auth warn",
+        "subscribed.service: service debug")
+
+    if err := SetLevels("auth=loud"); err == nil {
+        t.Fatal("expected an unknown level to be rejected")
+    }
+    if levels := Levels(); levels != "warn,service=debug" {
+        t.Errorf("levels %q after a rejected change", levels)
+    }
+}
+
+func TestConfigureRejectsUnknownLevel(t *testing.T) {
+    if err := Configure(Config{Level: "verbose"}); err == nil {
+        t.Fatal("expected an unknown default level to be rejected")
+    }
+    if err := Configure(Config{Level: "info", Levels: "auth=verbose"}); err == nil {
+        t.Fatal("expected an unknown subsystem level to be rejected")
+    }
+}
+
+func TestInitialize(t *testing.T) {
+    t.Cleanup(func() {
+        Configure(Config{Level: "debug"})
+    })
+    Initialize("error")
+    if Named("service").IsWarn() {
+        t.Error("warn enabled at level error")
+    }
+    // Unknown names fall back to info.
+    Initialize("verbose")
+    if !Named("service").IsInfo() || Named("service").IsDebug() {
+        t.Errorf("level %s for an unknown name, expected info", Levels())
+    }
+}
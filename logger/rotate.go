@@ -0,0 +1,80 @@
+package logger
+
+import (
+    "fmt"
+    "os"
+    "sync"
+)
+
+// A log file rotated by size, keeping maxBackups older files as path.1 to path.N.
+type rotatingFile struct {
+    path string
+    maxSize int64
+    maxBackups int
+    mutex sync.Mutex
+    file *os.File
+    size int64
+}
+
+func (f *rotatingFile) open() error {
+    file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+    f.file = file
+    f.size = info.Size()
+    return nil
+}
+
+// Shift the backups along, dropping the oldest, and start a new file.
+func (f *rotatingFile) rotate() error {
+    f.file.Close()
+    for i := f.maxBackups - 1; i >= 1; i-- {
+        os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i + 1))
+    }
+    if f.maxBackups > 0 {
+        os.Rename(f.path, f.path + ".1")
+    } else {
+        os.Remove(f.path)
+    }
+    return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    if f.maxSize > 0 && f.size > 0 && f.size + int64(len(p)) > f.maxSize {
+        if err := f.rotate(); err != nil {
+            return 0, err
+        }
+    }
+    n, err := f.file.Write(p)
+    f.size += int64(n)
+    return n, err
+}
+
+func (f *rotatingFile) Reopen() error {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    f.file.Close()
+    return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    return f.file.Close()
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+    f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+    if err := f.open(); err != nil {
+        return nil, err
+    }
+    return f, nil
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func readFile(t *testing.T, path string) string {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(data)
+}
+
+func TestRotation(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "test.log")
+    f, err := openRotatingFile(path, 10, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    for n := 1; n <= 4; n++ {
+        if _, err := fmt.Fprintf(f, "line %d\n", n); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // Each 7 byte line would overflow a 10 byte file, so each starts a new one.
+    expected := map[string]string{
+        path: "line 4\n",
+        path + ".1": "line 3\n",
+        path + ".2": "line 2\n",
+    }
+    for file, content := range expected {
+        if got := readFile(t, file); got != content {
+            t.Errorf("%s holds %q, expected %q", filepath.Base(file), got, content)
+        }
+    }
+    if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+        t.Errorf("kept more than 2 backups")
+    }
+}
+
+// A line longer than the maximum size is written whole.
+func TestRotationLongLine(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "test.log")
+    f, err := openRotatingFile(path, 10, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    long := strings.Repeat("x", 20) + "\n"
+    f.Write([]byte(long))
+    if got := readFile(t, path); got != long {
+        t.Errorf("file holds %q", got)
+    }
+}
+
+func TestRotationWithoutBackups(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "test.log")
+    f, err := openRotatingFile(path, 10, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    f.Write([]byte("line 1\n"))
+    f.Write([]byte("line 2\n"))
+    if got := readFile(t, path); got != "line 2\n" {
+        t.Errorf("file holds %q", got)
+    }
+    if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+        t.Errorf("kept a backup with no backups configured")
+    }
+}
+
+// Reopen continues appending to an existing file, e.g. after external rotation.
+func TestReopen(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "test.log")
+    f, err := openRotatingFile(path, 0, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    f.Write([]byte("before\n"))
+    if err := os.Rename(path, path + ".old"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Reopen(); err != nil {
+        t.Fatal(err)
+    }
+    f.Write([]byte("after\n"))
+    if got := readFile(t, path); got != "after\n" {
+        t.Errorf("reopened file holds %q", got)
+    }
+    if got := readFile(t, path + ".old"); got != "before\n" {
+        t.Errorf("moved file holds %q", got)
+    }
+}
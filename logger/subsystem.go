@@ -0,0 +1,82 @@
+package logger
+
+import (
+    "io"
+    stdlog "log"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/jupitercloud/subscribed/redact"
+)
+
+// Implements hclog.Logger by delegating every call to the subsystem's current logger.
+type subsystemLogger struct {
+    name string
+    args []interface{}
+}
+
+func (s *subsystemLogger) current() hclog.Logger {
+    l := get(s.name)
+    if len(s.args) > 0 {
+        return l.With(s.args...)
+    }
+    return l
+}
+
+// Arguments are redacted, see redact.Args, unless the level is disabled.
+func (s *subsystemLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+    l := s.current()
+    if level < l.GetLevel() {
+        return
+    }
+    l.Log(level, msg, redact.Args(args)...)
+}
+
+func (s *subsystemLogger) Trace(msg string, args ...interface{}) { s.Log(hclog.Trace, msg, args...) }
+func (s *subsystemLogger) Debug(msg string, args ...interface{}) { s.Log(hclog.Debug, msg, args...) }
+func (s *subsystemLogger) Info(msg string, args ...interface{}) { s.Log(hclog.Info, msg, args...) }
+func (s *subsystemLogger) Warn(msg string, args ...interface{}) { s.Log(hclog.Warn, msg, args...) }
+func (s *subsystemLogger) Error(msg string, args ...interface{}) { s.Log(hclog.Error, msg, args...) }
+
+func (s *subsystemLogger) IsTrace() bool { return get(s.name).IsTrace() }
+func (s *subsystemLogger) IsDebug() bool { return get(s.name).IsDebug() }
+func (s *subsystemLogger) IsInfo() bool { return get(s.name).IsInfo() }
+func (s *subsystemLogger) IsWarn() bool { return get(s.name).IsWarn() }
+func (s *subsystemLogger) IsError() bool { return get(s.name).IsError() }
+
+func (s *subsystemLogger) ImpliedArgs() []interface{} {
+    return s.args
+}
+
+func (s *subsystemLogger) With(args ...interface{}) hclog.Logger {
+    implied := append(append([]interface{}{}, s.args...), redact.Args(args)...)
+    return &subsystemLogger{name: s.name, args: implied}
+}
+
+func (s *subsystemLogger) Name() string {
+    return get(s.name).Name()
+}
+
+func (s *subsystemLogger) Named(name string) hclog.Logger {
+    return &subsystemLogger{name: s.name + "." + name, args: s.args}
+}
+
+func (s *subsystemLogger) ResetNamed(name string) hclog.Logger {
+    return &subsystemLogger{name: name, args: s.args}
+}
+
+// Override the subsystem level, until the next SetLevels or Configure.
+func (s *subsystemLogger) SetLevel(level hclog.Level) {
+    get(s.name).SetLevel(level)
+}
+
+func (s *subsystemLogger) GetLevel() hclog.Level {
+    return get(s.name).GetLevel()
+}
+
+func (s *subsystemLogger) StandardLogger(opts *hclog.StandardLoggerOptions) *stdlog.Logger {
+    return s.current().StandardLogger(opts)
+}
+
+func (s *subsystemLogger) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+    return s.current().StandardWriter(opts)
+}
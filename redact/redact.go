@@ -0,0 +1,249 @@
+// Package redact masks sensitive values before they reach logs, traces or
+// error details. Struct fields are marked with a redact tag:
+//
+//     Name string `json:"name" redact:"true"`
+//     AccountData Metadata `json:"accountData" redact:"metadata"`
+//
+// Fields tagged "true" are always masked. Fields tagged "metadata" are maps whose
+// values are masked by key, following the Policy set with Configure.
+package redact
+
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+)
+
+// Replacement for masked values.
+const Mask = "[REDACTED]"
+
+// Key names masked wherever they appear, e.g. in log arguments or error data.
+var sensitiveKeys = []string{"authorization", "token", "password", "secret", "credential", "apikey", "api_key"}
+
+// Which Metadata keys may be shown. Keys are matched case-insensitively.
+type Policy struct {
+    // When set, only these keys are shown.
+    AllowMetadataKeys []string
+    // Keys always masked, even when allowed. When set without an allow list,
+    // every other key is shown.
+    DenyMetadataKeys []string
+}
+
+// With no lists configured, every Metadata value is masked.
+var policy = struct {
+    mutex sync.RWMutex
+    allow map[string]bool
+    deny map[string]bool
+}{}
+
+func keySet(keys []string) map[string]bool {
+    if len(keys) == 0 {
+        return nil
+    }
+    set := make(map[string]bool)
+    for _, key := range keys {
+        set[strings.ToLower(key)] = true
+    }
+    return set
+}
+
+// Replace the Metadata policy.
+func Configure(p Policy) {
+    policy.mutex.Lock()
+    defer policy.mutex.Unlock()
+    policy.allow = keySet(p.AllowMetadataKeys)
+    policy.deny = keySet(p.DenyMetadataKeys)
+}
+
+func metadataKeyShown(key string) bool {
+    key = strings.ToLower(key)
+    policy.mutex.RLock()
+    defer policy.mutex.RUnlock()
+    if policy.deny[key] {
+        return false
+    }
+    if policy.allow != nil {
+        return policy.allow[key]
+    }
+    return policy.deny != nil
+}
+
+// Report whether values under this key name are always masked, e.g. "token"
+// or "clientSecret".
+func SensitiveKey(key string) bool {
+    key = strings.ToLower(key)
+    for _, sensitive := range sensitiveKeys {
+        if strings.Contains(key, sensitive) {
+            return true
+        }
+    }
+    return false
+}
+
+var (
+    timeType = reflect.TypeOf(time.Time{})
+    rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Copy v into plain maps, slices and values, with sensitive fields masked.
+// Struct fields are keyed by their JSON names.
+func Value(v interface{}) interface{} {
+    return value(reflect.ValueOf(v), false)
+}
+
+func value(v reflect.Value, metadata bool) interface{} {
+    switch v.Kind() {
+    case reflect.Invalid:
+        return nil
+    case reflect.Pointer, reflect.Interface:
+        if v.IsNil() {
+            return nil
+        }
+        return value(v.Elem(), metadata)
+    case reflect.Struct:
+        if v.Type() == timeType {
+            return v.Interface()
+        }
+        return structValue(v)
+    case reflect.Map:
+        if v.IsNil() {
+            return nil
+        }
+        result := make(map[string]interface{})
+        iter := v.MapRange()
+        for iter.Next() {
+            key := iter.Key()
+            if key.Kind() != reflect.String {
+                continue
+            }
+            name := key.String()
+            if SensitiveKey(name) || (metadata && !metadataKeyShown(name)) {
+                result[name] = Mask
+            } else {
+                result[name] = value(iter.Value(), false)
+            }
+        }
+        return result
+    case reflect.Slice, reflect.Array:
+        if v.Type() == rawMessageType {
+            // Decode raw JSON, so sensitive keys inside it are masked.
+            if v.Len() == 0 {
+                return nil
+            }
+            var decoded interface{}
+            if json.Unmarshal(v.Bytes(), &decoded) != nil {
+                return Mask
+            }
+            return value(reflect.ValueOf(decoded), metadata)
+        }
+        if v.Kind() == reflect.Slice && v.IsNil() {
+            return nil
+        }
+        result := make([]interface{}, v.Len())
+        for i := range result {
+            result[i] = value(v.Index(i), metadata)
+        }
+        return result
+    default:
+        return v.Interface()
+    }
+}
+
+func structValue(v reflect.Value) map[string]interface{} {
+    result := make(map[string]interface{})
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if !field.IsExported() {
+            continue
+        }
+        name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+        if name == "-" {
+            continue
+        }
+        if name == "" {
+            name = field.Name
+        }
+        switch field.Tag.Get("redact") {
+        case "true":
+            if !v.Field(i).IsZero() {
+                result[name] = Mask
+            } else {
+                result[name] = value(v.Field(i), false)
+            }
+        case "metadata":
+            result[name] = value(v.Field(i), true)
+        default:
+            if SensitiveKey(name) && !v.Field(i).IsZero() {
+                result[name] = Mask
+            } else {
+                result[name] = value(v.Field(i), false)
+            }
+        }
+    }
+    return result
+}
+
+// Encode v as JSON with sensitive fields masked, e.g. for a span attribute.
+func JSON(v interface{}) string {
+    encoded, err := json.Marshal(Value(v))
+    if err != nil {
+        return Mask
+    }
+    return string(encoded)
+}
+
+// Mask the Data of a json2 error. Other errors are returned unchanged.
+func Error(err error) error {
+    rpcErr, ok := err.(*json2.Error)
+    if !ok || rpcErr.Data == nil {
+        return err
+    }
+    return &json2.Error{
+        Code: rpcErr.Code,
+        Message: rpcErr.Message,
+        Data: Value(rpcErr.Data),
+    }
+}
+
+// Mask hclog style key/value pairs: values under sensitive keys, and sensitive
+// fields of structured values.
+func Args(args []interface{}) []interface{} {
+    if len(args) == 0 {
+        return args
+    }
+    result := make([]interface{}, len(args))
+    for i, arg := range args {
+        if i % 2 == 1 {
+            if key, ok := args[i - 1].(string); ok && SensitiveKey(key) {
+                arg = Mask
+            } else {
+                arg = argValue(arg)
+            }
+        }
+        result[i] = arg
+    }
+    return result
+}
+
+// Redact structured log values, leaving scalars and errors to hclog's formatting.
+func argValue(arg interface{}) interface{} {
+    if err, ok := arg.(error); ok {
+        return Error(err)
+    }
+    switch reflect.Indirect(reflect.ValueOf(arg)).Kind() {
+    case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+        if _, ok := arg.(time.Time); ok {
+            return arg
+        }
+        if _, ok := arg.([]byte); ok {
+            return arg
+        }
+        return Value(arg)
+    }
+    return arg
+}
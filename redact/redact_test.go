@@ -0,0 +1,126 @@
+package redact
+
+import (
+    "encoding/json"
+    "fmt"
+    "testing"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+)
+
+// Encode a redacted value for comparison.
+func encode(t *testing.T, v interface{}) string {
+    t.Helper()
+    encoded, err := json.Marshal(v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(encoded)
+}
+
+func configurePolicy(t *testing.T, p Policy) {
+    Configure(p)
+    t.Cleanup(func() {
+        Configure(Policy{})
+    })
+}
+
+func TestTaggedFields(t *testing.T) {
+    request := &api.OpenAccountRequest{
+        AccountId: "acct-1",
+        Name: "Ada Lovelace",
+        Addresses: []api.Address{{AddressId: "addr-1", Line1: "12 St James's Square", City: "London", Country: "GB"}},
+    }
+    expected := `{"accountId":"acct-1","addresses":[{"addressId":"addr-1","addressType":"","city":"[REDACTED]",` +
+        `"country":"GB","line1":"[REDACTED]","line2":"","postalCode":"","state":""}],"name":"[REDACTED]"}`
+    if got := JSON(request); got != expected {
+        t.Errorf("redacted to %s, expected %s", got, expected)
+    }
+}
+
+func TestRawConfiguration(t *testing.T) {
+    request := &api.CreateResourceRequest{
+        ResourceId: "res-1",
+        Configuration: json.RawMessage(`{"region":"eu"}`),
+    }
+    value := Value(request).(map[string]interface{})
+    if value["configuration"] != Mask {
+        t.Errorf("configuration redacted to %v", value["configuration"])
+    }
+    // Sensitive keys inside untagged raw JSON are masked.
+    masked := Value(json.RawMessage(`{"region":"eu","apiKey":"k-123"}`))
+    if got := encode(t, masked); got != `{"apiKey":"[REDACTED]","region":"eu"}` {
+        t.Errorf("raw JSON redacted to %s", got)
+    }
+}
+
+func TestMetadataPolicy(t *testing.T) {
+    request := &api.CloseAccountRequest{
+        AccountId: "acct-1",
+        AccountData: api.Metadata{"plan": "gold", "Email": "ada@example.com", "clientSecret": "s"},
+    }
+    policies := map[string]struct {
+        policy Policy
+        expected string
+    }{
+        "default": {Policy{}, `{"Email":"[REDACTED]","clientSecret":"[REDACTED]","plan":"[REDACTED]"}`},
+        "allow": {Policy{AllowMetadataKeys: []string{"PLAN", "clientSecret"}}, `{"Email":"[REDACTED]","clientSecret":"[REDACTED]","plan":"gold"}`},
+        "deny": {Policy{DenyMetadataKeys: []string{"email"}}, `{"Email":"[REDACTED]","clientSecret":"[REDACTED]","plan":"gold"}`},
+        "allow and deny": {Policy{AllowMetadataKeys: []string{"plan", "email"}, DenyMetadataKeys: []string{"email"}}, `{"Email":"[REDACTED]","clientSecret":"[REDACTED]","plan":"gold"}`},
+    }
+    for name, p := range policies {
+        t.Run(name, func(t *testing.T) {
+            configurePolicy(t, p.policy)
+            value := Value(request).(map[string]interface{})
+            if got := encode(t, value["accountData"]); got != p.expected {
+                t.Errorf("metadata redacted to %s, expected %s", got, p.expected)
+            }
+            if value["accountId"] != "acct-1" {
+                t.Errorf("account ID redacted to %v", value["accountId"])
+            }
+        })
+    }
+}
+
+func TestError(t *testing.T) {
+    err := &json2.Error{
+        Code: -1004,
+        Message: "Invalid argument",
+        Data: map[string]interface{}{"field": "name", "token": "eyJhbGciOi"},
+    }
+    masked := Error(err).(*json2.Error)
+    if masked.Code != err.Code || masked.Message != err.Message {
+        t.Errorf("error changed to %v", masked)
+    }
+    if got := encode(t, masked.Data); got != `{"field":"name","token":"[REDACTED]"}` {
+        t.Errorf("data redacted to %s", got)
+    }
+    // The original error is not modified.
+    if err.Data.(map[string]interface{})["token"] != "eyJhbGciOi" {
+        t.Error("original error data modified")
+    }
+    plain := fmt.Errorf("plain")
+    if Error(plain) != plain {
+        t.Error("non-json2 error changed")
+    }
+}
+
+func TestArgs(t *testing.T) {
+    args := Args([]interface{}{
+        "authorization", "Bearer eyJhbGciOi",
+        "user-password", "hunter2",
+        "request", &api.OpenAccountRequest{AccountId: "acct-1", Name: "Ada"},
+        "account-id", "acct-1",
+        "count", 3,
+    })
+    if args[1] != Mask || args[3] != Mask {
+        t.Errorf("sensitive keys redacted to %v and %v", args[1], args[3])
+    }
+    if got := encode(t, args[5]); got != `{"accountId":"acct-1","addresses":null,"name":"[REDACTED]"}` {
+        t.Errorf("request redacted to %s", got)
+    }
+    if args[7] != "acct-1" || args[9] != 3 {
+        t.Errorf("plain values changed to %v and %v", args[7], args[9])
+    }
+}
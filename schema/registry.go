@@ -0,0 +1,117 @@
+// Package schema validates resource Configuration against a JSON Schema registered per SKU.
+package schema
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/logger"
+    "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var log = logger.Named("schema");
+
+// Registry of configuration schemas, keyed by SKU.
+type Registry struct {
+    mutex sync.RWMutex
+    schemas map[int64]*jsonschema.Schema
+}
+
+// Compile and register the JSON Schema for a SKU, replacing any previous schema.
+func (r *Registry) Register(sku int64, schema []byte) error {
+    url := fmt.Sprintf("sku-%d.json", sku)
+    compiler := jsonschema.NewCompiler()
+    if err := compiler.AddResource(url, bytes.NewReader(schema)); err != nil {
+        return err
+    }
+    compiled, err := compiler.Compile(url)
+    if err != nil {
+        return err
+    }
+
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    r.schemas[sku] = compiled
+    log.Debug("Registered configuration schema", "sku", sku)
+    return nil
+}
+
+// Register the JSON Schema for a SKU from a file.
+func (r *Registry) RegisterFile(sku int64, path string) error {
+    schema, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    return r.Register(sku, schema)
+}
+
+// Remove the schema for a SKU, if any.
+func (r *Registry) Remove(sku int64) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    delete(r.schemas, sku)
+}
+
+// Report whether a schema is registered for the SKU.
+func (r *Registry) Has(sku int64) bool {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+    _, ok := r.schemas[sku]
+    return ok
+}
+
+// Validate a resource configuration against the schema registered for its SKU.
+// An absent configuration is validated as JSON null.
+func (r *Registry) Validate(sku int64, configuration json.RawMessage) *json2.Error {
+    r.mutex.RLock()
+    compiled, ok := r.schemas[sku]
+    r.mutex.RUnlock()
+    if !ok {
+        return errors.UnsupportedSkuError(sku)
+    }
+
+    if len(configuration) == 0 {
+        configuration = json.RawMessage("null")
+    }
+    decoder := json.NewDecoder(bytes.NewReader(configuration))
+    decoder.UseNumber()
+    var value interface{}
+    if err := decoder.Decode(&value); err != nil {
+        return invalidConfiguration("", err.Error())
+    }
+
+    err := compiled.Validate(value)
+    if err == nil {
+        return nil
+    }
+    validationErr, ok := err.(*jsonschema.ValidationError)
+    if !ok {
+        return invalidConfiguration("", err.Error())
+    }
+    // Report the most specific failure.
+    leaf := validationErr
+    for len(leaf.Causes) > 0 {
+        leaf = leaf.Causes[0]
+    }
+    return invalidConfiguration(leaf.InstanceLocation, leaf.Message)
+}
+
+// Build an InvalidArgumentError locating the failure within the request by JSON pointer.
+func invalidConfiguration(location string, message string) *json2.Error {
+    pointer := "/configuration" + location
+    err := errors.InvalidArgumentError(pointer + ": " + strings.TrimSpace(message))
+    err.Data = map[string]interface{}{
+        "pointer": pointer,
+    }
+    return err
+}
+
+func NewRegistry() *Registry {
+    return &Registry{schemas: make(map[int64]*jsonschema.Schema)}
+}
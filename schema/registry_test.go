@@ -0,0 +1,93 @@
+package schema
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+const testSchema = `{
+    "type": "object",
+    "properties": {
+        "size": {"enum": ["small", "large"]},
+        "disks": {"type": "array", "items": {"type": "integer", "minimum": 1}}
+    },
+    "required": ["size"]
+}`
+
+func TestValidate(t *testing.T) {
+    registry := NewRegistry()
+    if err := registry.Register(1, []byte(testSchema)); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name string
+        configuration string
+        pointer string
+    }{
+        {"valid", `{"size": "small", "disks": [1, 2]}`, ""},
+        {"wrong enum", `{"size": "medium"}`, "/configuration/size"},
+        {"nested", `{"size": "large", "disks": [1, 0]}`, "/configuration/disks/1"},
+        {"missing required", `{}`, "/configuration"},
+        {"absent", ``, "/configuration"},
+        {"malformed", `{"size":`, "/configuration"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := registry.Validate(1, json.RawMessage(test.configuration))
+            if test.pointer == "" {
+                if err != nil {
+                    t.Fatalf("unexpected error: %v", err)
+                }
+                return
+            }
+            if err == nil || err.Code != errors.CodeInvalidArgument {
+                t.Fatalf("expected an invalid argument error, got %v", err)
+            }
+            data, _ := err.Data.(map[string]interface{})
+            if data["pointer"] != test.pointer {
+                t.Errorf("pointer %v, expected %s", data["pointer"], test.pointer)
+            }
+            if !strings.Contains(err.Message, test.pointer + ": ") {
+                t.Errorf("message %q does not locate the failure", err.Message)
+            }
+        })
+    }
+}
+
+func TestUnregisteredSku(t *testing.T) {
+    registry := NewRegistry()
+    if err := registry.Validate(2, json.RawMessage(`{}`)); err == nil || err.Code != errors.CodeUnsupportedSku {
+        t.Fatalf("expected an unsupported SKU error, got %v", err)
+    }
+
+    path := filepath.Join(t.TempDir(), "sku-2.json")
+    if err := os.WriteFile(path, []byte(testSchema), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err := registry.RegisterFile(2, path); err != nil {
+        t.Fatal(err)
+    }
+    if !registry.Has(2) {
+        t.Fatal("expected the SKU to be registered")
+    }
+    registry.Remove(2)
+    if registry.Has(2) {
+        t.Fatal("expected the SKU to be removed")
+    }
+}
+
+func TestRegisterInvalidSchema(t *testing.T) {
+    registry := NewRegistry()
+    if err := registry.Register(1, []byte(`{"type": 5}`)); err == nil {
+        t.Fatal("expected an invalid schema to be rejected")
+    }
+    if registry.Has(1) {
+        t.Fatal("invalid schema was registered")
+    }
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    rpc "github.com/gorilla/rpc/v2"
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/logger"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+)
+
+var accessLog = logger.Named("access");
+
+const requestIdHeader = "X-Request-Id"
+
+// Longest X-Request-Id accepted from a caller. Longer values are replaced.
+const maxRequestIdLength = 128
+
+// Identifiers common to request types, read generically from any request.
+type requestIds struct {
+    AccountId string `json:"accountId"`
+    SubscriptionId string `json:"subscriptionId"`
+    ResourceId string `json:"resourceId"`
+    OperationId string `json:"operationId"`
+    Sku int64 `json:"sku"`
+    // UpdateSubscription's target SKU.
+    NewSku int64 `json:"newSku"`
+}
+
+func readRequestIds(args interface{}) requestIds {
+    var ids requestIds
+    if encoded, err := json.Marshal(args); err == nil {
+        json.Unmarshal(encoded, &ids)
+    }
+    return ids
+}
+
+// Details of one RPC, filled in as the request passes through the RPC hooks.
+type accessEntry struct {
+    start time.Time
+    method string
+    jsonRpcId interface{}
+    ids requestIds
+    // Set once the RPC server dispatched the method.
+    dispatched bool
+    errorCode json2.ErrorCode
+    span trace.SpanContext
+}
+
+// Captures the response status for the access log.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+    r.status = status
+    r.ResponseWriter.WriteHeader(status)
+}
+
+func newRequestId() string {
+    var buf [16]byte
+    if _, err := rand.Read(buf[:]); err != nil {
+        panic(err)
+    }
+    return hex.EncodeToString(buf[:])
+}
+
+// Propagate the caller's X-Request-Id, or generate one, and echo it in the response.
+func requestIdMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        requestId := request.Header.Get(requestIdHeader)
+        if requestId == "" || len(requestId) > maxRequestIdLength || strings.ContainsAny(requestId, "\r\n") {
+            requestId = newRequestId()
+        }
+        response.Header().Set(requestIdHeader, requestId)
+        trace.SpanFromContext(request.Context()).SetAttributes(attribute.String("http.request_id", requestId))
+        ctx := context.WithValue(request.Context(), "requestId", requestId)
+        next.ServeHTTP(response, request.WithContext(ctx))
+    })
+}
+
+// The request ID set by requestIdMiddleware.
+func requestIdFromContext(ctx context.Context) string {
+    requestId, _ := ctx.Value("requestId").(string)
+    return requestId
+}
+
+// Read the JSON-RPC id and method from the body, leaving it intact for the RPC server.
+func peekJsonRpc(request *http.Request, entry *accessEntry) {
+    if request.Body == nil {
+        return
+    }
+    body, err := io.ReadAll(request.Body)
+    request.Body.Close()
+    request.Body = io.NopCloser(bytes.NewReader(body))
+    if err != nil {
+        return
+    }
+    var envelope struct {
+        Id interface{} `json:"id"`
+        Method string `json:"method"`
+    }
+    if json.Unmarshal(body, &envelope) == nil {
+        entry.jsonRpcId = envelope.Id
+        entry.method = envelope.Method[strings.LastIndex(envelope.Method, ".") + 1:]
+    }
+}
+
+// Log one line per RPC request, after the response is written.
+func accessLogMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        entry := &accessEntry{
+            start: time.Now(),
+            span: trace.SpanContextFromContext(request.Context()),
+        }
+        peekJsonRpc(request, entry)
+        recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+        ctx := context.WithValue(request.Context(), "accessEntry", entry)
+        next.ServeHTTP(recorder, request.WithContext(ctx))
+
+        // Requests rejected by the RPC server, e.g. for an unknown method, never dispatch.
+        status := "invalid"
+        if entry.dispatched && entry.errorCode == 0 {
+            status = "ok"
+        } else if entry.dispatched {
+            status = "error"
+        }
+        fields := []interface{}{
+            "method", entry.method,
+            "jsonrpc-id", entry.jsonRpcId,
+            "status", status,
+            "http-status", recorder.status,
+            "latency", time.Since(entry.start),
+            "request-id", requestIdFromContext(request.Context()),
+        }
+        if entry.span.IsValid() {
+            fields = append(fields, "trace-id", entry.span.TraceID().String(), "span-id", entry.span.SpanID().String())
+        }
+        if entry.ids.AccountId != "" {
+            fields = append(fields, "account-id", entry.ids.AccountId)
+        }
+        if entry.ids.SubscriptionId != "" {
+            fields = append(fields, "subscription-id", entry.ids.SubscriptionId)
+        }
+        if entry.ids.ResourceId != "" {
+            fields = append(fields, "resource-id", entry.ids.ResourceId)
+        }
+        if entry.errorCode != 0 {
+            fields = append(fields, "code", int(entry.errorCode))
+        }
+        accessLog.Info("RPC", fields...)
+    })
+}
+
+func accessEntryFromContext(ctx context.Context) *accessEntry {
+    entry, _ := ctx.Value("accessEntry").(*accessEntry)
+    return entry
+}
+
+// The request IDs captured by rpcHookValidate, or read from args when the
+// request did not pass through the access log.
+func requestIdsFor(request *http.Request, args interface{}) requestIds {
+    if entry := accessEntryFromContext(request.Context()); entry != nil {
+        return entry.ids
+    }
+    return readRequestIds(args)
+}
+
+// Capture the request IDs once, for the access log, metrics and audit. Registered
+// as the RPC server's validate function, the only hook which sees the decoded arguments.
+func rpcHookValidate(info *rpc.RequestInfo, args interface{}) error {
+    if entry := accessEntryFromContext(info.Request.Context()); entry != nil {
+        entry.ids = readRequestIds(args)
+    }
+    return nil
+}
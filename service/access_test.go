@@ -0,0 +1,164 @@
+package service
+
+import (
+    "bufio"
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+    "github.com/jupitercloud/subscribed/logger"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Log JSON lines to a file until the test ends. Returns a function reading
+// the lines logged by a subsystem so far, or by all with an empty name.
+func captureLogs(t *testing.T) func(module string) []map[string]interface{} {
+    path := filepath.Join(t.TempDir(), "test.log")
+    if err := logger.Configure(logger.Config{Level: "debug", JSONFormat: true, File: path}); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        logger.Configure(logger.Config{Level: "debug"})
+    })
+    return func(module string) []map[string]interface{} {
+        file, err := os.Open(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer file.Close()
+        var lines []map[string]interface{}
+        scanner := bufio.NewScanner(file)
+        for scanner.Scan() {
+            var line map[string]interface{}
+            if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+                t.Fatalf("log line %q: %v", scanner.Text(), err)
+            }
+            if module == "" || line["@module"] == "subscribed." + module {
+                lines = append(lines, line)
+            }
+        }
+        return lines
+    }
+}
+
+// Installed once: tracers created before the first global provider delegate
+// to it, and ignore providers set later.
+var testTracerProvider = sync.OnceValue(func() *sdktrace.TracerProvider {
+    provider := sdktrace.NewTracerProvider()
+    otel.SetTracerProvider(provider)
+    otel.SetTextMapPropagator(propagation.TraceContext{})
+    return provider
+})
+
+// Trace requests with a recording tracer, propagating W3C trace context.
+// Returns the recorder of spans ended until the test ends.
+func recordTraces(t *testing.T) *tracetest.SpanRecorder {
+    provider := testTracerProvider()
+    recorder := tracetest.NewSpanRecorder()
+    provider.RegisterSpanProcessor(recorder)
+    t.Cleanup(func() {
+        provider.UnregisterSpanProcessor(recorder)
+    })
+    return recorder
+}
+
+// Post a raw JSON-RPC body with headers, returning the response.
+func postRpc(t *testing.T, url string, body string, headers map[string]string) *http.Response {
+    request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+    if err != nil {
+        t.Fatal(err)
+    }
+    request.Header.Set("Content-Type", "application/json")
+    for name, value := range headers {
+        request.Header.Set(name, value)
+    }
+    response, err := http.DefaultClient.Do(request)
+    if err != nil {
+        t.Fatal(err)
+    }
+    response.Body.Close()
+    return response
+}
+
+// Wait for count access log lines. Lines are logged after the response is written.
+func waitForAccessLog(t *testing.T, read func(string) []map[string]interface{}, count int) []map[string]interface{} {
+    t.Helper()
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        if lines := read("access"); len(lines) >= count {
+            return lines
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("fewer than %d access log lines", count)
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+func TestAccessLog(t *testing.T) {
+    read := captureLogs(t)
+    recordTraces(t)
+    i, url := startTestServer(t, ServerConfig{}, &testService{})
+    token, err := i.Mint(issuer.TokenClaims{VendorId: testVendorId, AccountId: "acct-1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+    ok := postRpc(t, url, `{"jsonrpc":"2.0","id":7,"method":"SubscriptionService.CreateSubscription",` +
+        `"params":{"accountId":"acct-1","subscriptionId":"sub-1","sku":1}}`, map[string]string{
+        "Authorization": token,
+        requestIdHeader: "caller-request-1",
+        "traceparent": "00-" + traceId + "-00f067aa0ba902b7-01",
+    })
+    if got := ok.Header.Get(requestIdHeader); got != "caller-request-1" {
+        t.Errorf("echoed request ID %q, expected the caller's", got)
+    }
+    failed := postRpc(t, url, `{"jsonrpc":"2.0","id":"b","method":"SubscriptionService.CreateSubscription",` +
+        `"params":{"accountId":"acct-2","subscriptionId":"sub-2","sku":1}}`, map[string]string{
+        "Authorization": token,
+        requestIdHeader: strings.Repeat("x", maxRequestIdLength + 1),
+    })
+    generated := failed.Header.Get(requestIdHeader)
+    if !regexp.MustCompile("^[0-9a-f]{32}$").MatchString(generated) {
+        t.Errorf("overlong request ID replaced by %q, expected a generated ID", generated)
+    }
+    postRpc(t, url, `{"jsonrpc":"2.0","id":3,"method":"SubscriptionService.NoSuchMethod","params":{}}`, map[string]string{
+        "Authorization": token,
+    })
+
+    lines := waitForAccessLog(t, read, 3)
+    expected := []map[string]interface{}{
+        {"method": "CreateSubscription", "jsonrpc-id": float64(7), "status": "ok", "http-status": float64(200),
+            "request-id": "caller-request-1", "trace-id": traceId, "account-id": "acct-1", "subscription-id": "sub-1"},
+        {"method": "CreateSubscription", "jsonrpc-id": "b", "status": "error", "request-id": generated,
+            "account-id": "acct-2", "code": float64(errors.CodeAccountScope)},
+        {"method": "NoSuchMethod", "jsonrpc-id": float64(3), "status": "invalid"},
+    }
+    for n, fields := range expected {
+        for name, value := range fields {
+            if lines[n][name] != value {
+                t.Errorf("line %d: %s is %v, expected %v", n, name, lines[n][name], value)
+            }
+        }
+        if _, ok := lines[n]["latency"]; !ok {
+            t.Errorf("line %d has no latency", n)
+        }
+    }
+    if spanId, _ := lines[0]["span-id"].(string); len(spanId) != 16 || spanId == "00f067aa0ba902b7" {
+        t.Errorf("span ID %q, expected the server's own span", spanId)
+    }
+    if _, ok := lines[2]["code"]; ok {
+        t.Errorf("undispatched request logged a code")
+    }
+}
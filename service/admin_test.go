@@ -0,0 +1,114 @@
+package service
+
+import (
+    "io"
+    "net/http"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/logger"
+)
+
+// Send an admin request, retrying until the admin server is listening.
+func adminRequest(t *testing.T, method string, url string, token string, body string) (int, string) {
+    t.Helper()
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        request, err := http.NewRequest(method, url, strings.NewReader(body))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if token != "" {
+            request.Header.Set("Authorization", "Bearer " + token)
+        }
+        response, err := http.DefaultClient.Do(request)
+        if err == nil {
+            defer response.Body.Close()
+            data, _ := io.ReadAll(response.Body)
+            return response.StatusCode, string(data)
+        }
+        if time.Now().After(deadline) {
+            t.Fatal(err)
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+func TestAdminToken(t *testing.T) {
+    t.Cleanup(func() {
+        logger.Configure(logger.Config{Level: "debug"})
+    })
+    config := ServerConfig{AdminAddress: freeAddress(t), AdminToken: "admin-secret"}
+    startTestServer(t, config, &testService{})
+    url := "http://" + config.AdminAddress + "/log-levels"
+
+    if status, _ := adminRequest(t, http.MethodPut, url, "", "off"); status != http.StatusUnauthorized {
+        t.Errorf("PUT without a token returned %d", status)
+    }
+    if status, _ := adminRequest(t, http.MethodGet, url, "wrong", ""); status != http.StatusUnauthorized {
+        t.Errorf("GET with a wrong token returned %d", status)
+    }
+    if logger.Levels() == "off" {
+        t.Fatal("unauthorized PUT changed the levels")
+    }
+    status, body := adminRequest(t, http.MethodPut, url, "admin-secret", "info,auth=debug")
+    if status != http.StatusOK || body != "info,auth=debug\n" {
+        t.Errorf("PUT with the token returned %d %q", status, body)
+    }
+}
+
+func TestPublicAdminAddressRequiresToken(t *testing.T) {
+    config := ServerConfig{
+        Issuer: "http://127.0.0.1:1",
+        VendorId: testVendorId,
+        Address: freeAddress(t),
+        AdminAddress: "0.0.0.0:0",
+    }
+    quit := make(chan os.Signal, 1)
+    err := RunServer(config, &testService{}, quit)
+    if err == nil || !strings.Contains(err.Error(), "requires an admin token") {
+        t.Fatalf("expected a missing admin token error, got %v", err)
+    }
+
+    for address, loopback := range map[string]bool{
+        "localhost:8082": true,
+        "127.0.0.1:8082": true,
+        "[::1]:8082": true,
+        ":8082": false,
+        "10.0.0.1:8082": false,
+    } {
+        if isLoopbackAddress(address) != loopback {
+            t.Errorf("%s loopback %v, expected %v", address, !loopback, loopback)
+        }
+    }
+}
+
+func TestMetricsOnAdminOnly(t *testing.T) {
+    metrics := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        io.WriteString(response, "rpc_server_requests_total 1\n")
+    })
+    config := ServerConfig{AdminAddress: freeAddress(t), MetricsHandler: metrics}
+    _, url := startTestServer(t, config, &testService{})
+
+    status, body := adminRequest(t, http.MethodGet, "http://" + config.AdminAddress + "/metrics", "", "")
+    if status != http.StatusOK || body != "rpc_server_requests_total 1\n" {
+        t.Errorf("admin /metrics returned %d %q", status, body)
+    }
+    public := strings.TrimSuffix(url, "/rpc") + "/metrics"
+    if status, _ := adminRequest(t, http.MethodGet, public, "", ""); status != http.StatusNotFound {
+        t.Errorf("public /metrics returned %d", status)
+    }
+
+    // Without an admin address, metrics are not served at all.
+    config = ServerConfig{
+        Issuer: "http://127.0.0.1:1",
+        VendorId: testVendorId,
+        Address: freeAddress(t),
+        MetricsHandler: metrics,
+    }
+    err := RunServer(config, &testService{}, make(chan os.Signal, 1))
+    if err == nil || !strings.Contains(err.Error(), "requires an admin address") {
+        t.Fatalf("expected a missing admin address error, got %v", err)
+    }
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/audit"
+    "github.com/jupitercloud/subscribed/auth"
+)
+
+// A record of a request's method and caller, with a success outcome.
+func newAuditRecord(request *http.Request, method string, start time.Time) audit.Record {
+    record := audit.Record{
+        Time: start.UTC(),
+        Method: method,
+        RequestId: requestIdFromContext(request.Context()),
+        Outcome: audit.OutcomeSuccess,
+        LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+    }
+    if claims, ok := request.Context().Value("claims").(*auth.Claims); ok && claims != nil {
+        record.VendorId = claims.VendorId
+        record.TokenAccountId = claims.AccountId
+        record.Subject = claims.Subject
+        record.TokenId = claims.TokenId
+        if claims.Client != nil {
+            record.ClientCommonName = claims.Client.CommonName
+        }
+    }
+    return record
+}
+
+func appendAuditRecord(auditLog *audit.Log, record audit.Record) {
+    if err := auditLog.Append(record); err != nil {
+        log.Error("Failed to write audit record", "method", record.Method, "error", err)
+    }
+}
+
+// Append an audit record for a completed RPC. Audit failures do not fail the RPC.
+func (self *SubscriptionService) audit(request *http.Request, method string, args interface{}, start time.Time, err error) {
+    if self.auditLog == nil {
+        return
+    }
+    record := newAuditRecord(request, method, start)
+    ids := requestIdsFor(request, args)
+    record.AccountId = ids.AccountId
+    record.SubscriptionId = ids.SubscriptionId
+    record.ResourceId = ids.ResourceId
+    record.OperationId = ids.OperationId
+
+    if err != nil {
+        record.Outcome = audit.OutcomeError
+        record.ErrorCode = int(rpcErrorCode(err))
+    }
+    appendAuditRecord(self.auditLog, record)
+}
+
+// Audit RPC requests rejected before reaching a method, e.g. for an unknown
+// method, undecodable parameters or an unknown vendor path. Dispatched calls,
+// including those failing authorization, are audited by the method wrapper.
+// Must run inside accessLogMiddleware.
+func auditRejectedMiddleware(auditLog *audit.Log, next http.Handler) http.Handler {
+    if auditLog == nil {
+        return next
+    }
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        start := time.Now()
+        next.ServeHTTP(response, request)
+
+        entry := accessEntryFromContext(request.Context())
+        if entry == nil || entry.dispatched || request.Method != http.MethodPost {
+            return
+        }
+        record := newAuditRecord(request, entry.method, start)
+        record.Outcome = audit.OutcomeRejected
+        record.ErrorCode = int(json2.E_INVALID_REQ)
+        if claims, ok := request.Context().Value("claims").(*auth.Claims); ok && claims != nil && claims.Error != nil {
+            record.ErrorCode = int(rpcErrorCode(claims.Error))
+        }
+        appendAuditRecord(auditLog, record)
+    })
+}
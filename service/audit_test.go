@@ -0,0 +1,97 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/audit"
+    "github.com/jupitercloud/subscribed/client"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+var testAuditKey = []byte("0123456789abcdef0123456789abcdef")
+
+// Wait for count records in the audit log, verifying its chain. Rejected
+// requests are audited after their response is written.
+func readAuditLog(t *testing.T, path string, count int) []audit.Record {
+    t.Helper()
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if n, _, err := audit.Verify(bytes.NewReader(data), testAuditKey); err != nil {
+            t.Fatal(err)
+        } else if n >= count {
+            var records []audit.Record
+            audit.Read(bytes.NewReader(data), func(record audit.Record) error {
+                records = append(records, record)
+                return nil
+            })
+            return records
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("audit log has fewer than %d records", count)
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+func TestAuditFailures(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    config := ServerConfig{AuditLog: audit.NewLog(path, testAuditKey), ScopePolicy: DefaultScopePolicy}
+    i, url := startTestServer(t, config, &testService{})
+    ctx := context.Background()
+    create := &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}
+
+    writer := newTestClient(t, i, url, issuer.TokenClaims{Subject: "writer", Scopes: []string{ScopeProvisionWrite}})
+    if _, err := writer.CreateSubscription(ctx, create); err != nil {
+        t.Fatal(err)
+    }
+    _, err := client.NewClient(url).CreateSubscription(ctx, create)
+    expectCode(t, err, errors.CodeUnauthenticated)
+    unscoped := newTestClient(t, i, url, issuer.TokenClaims{Subject: "unscoped"})
+    _, err = unscoped.CreateSubscription(ctx, create)
+    expectCode(t, err, errors.CodeForbidden)
+    // Rejected by the RPC server before reaching a method.
+    if err := unscoped.Call(ctx, "NoSuchMethod", create, &struct{}{}); err == nil {
+        t.Fatal("expected an unknown method to fail")
+    }
+    if err := unscoped.Call(ctx, "CreateSubscription", "not an object", &struct{}{}); err == nil {
+        t.Fatal("expected undecodable parameters to fail")
+    }
+
+    expected := []struct {
+        method string
+        subject string
+        outcome string
+        code json2.ErrorCode
+    }{
+        {"CreateSubscription", "writer", audit.OutcomeSuccess, 0},
+        {"CreateSubscription", "", audit.OutcomeError, errors.CodeUnauthenticated},
+        {"CreateSubscription", "unscoped", audit.OutcomeError, errors.CodeForbidden},
+        {"NoSuchMethod", "unscoped", audit.OutcomeRejected, json2.E_INVALID_REQ},
+        {"CreateSubscription", "unscoped", audit.OutcomeRejected, json2.E_INVALID_REQ},
+    }
+    records := readAuditLog(t, path, len(expected))
+    if len(records) != len(expected) {
+        t.Fatalf("audit log has %d records, expected %d", len(records), len(expected))
+    }
+    for n, e := range expected {
+        r := records[n]
+        if r.Method != e.method || r.Subject != e.subject || r.Outcome != e.outcome || r.ErrorCode != int(e.code) {
+            t.Errorf("record %d: %s by %q, %s %d; expected %s by %q, %s %d",
+                n, r.Method, r.Subject, r.Outcome, r.ErrorCode, e.method, e.subject, e.outcome, e.code)
+        }
+        if r.RequestId == "" {
+            t.Errorf("record %d has no request ID", n)
+        }
+    }
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "reflect"
+    "sync"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/store"
+)
+
+// Serializes calls sharing a platform-assigned ID, so a retried request
+// cannot race the original into the implementation.
+type idLocker struct {
+    mutex sync.Mutex
+    locks map[string]*idLock
+}
+
+type idLock struct {
+    mutex sync.Mutex
+    refs int
+}
+
+func (l *idLocker) lock(id string) func() {
+    l.mutex.Lock()
+    if l.locks == nil {
+        l.locks = make(map[string]*idLock)
+    }
+    entry, ok := l.locks[id]
+    if !ok {
+        entry = &idLock{}
+        l.locks[id] = entry
+    }
+    entry.refs++
+    l.mutex.Unlock()
+
+    entry.mutex.Lock()
+    return func() {
+        entry.mutex.Unlock()
+        l.mutex.Lock()
+        entry.refs--
+        if entry.refs == 0 {
+            delete(l.locks, id)
+        }
+        l.mutex.Unlock()
+    }
+}
+
+// Compare two JSON documents semantically, ignoring formatting and key order.
+func sameJson(a json.RawMessage, b json.RawMessage) bool {
+    if bytes.Equal(a, b) {
+        return true
+    }
+    var va, vb interface{}
+    if len(a) > 0 && json.Unmarshal(a, &va) != nil {
+        return false
+    }
+    if len(b) > 0 && json.Unmarshal(b, &vb) != nil {
+        return false
+    }
+    return reflect.DeepEqual(va, vb)
+}
+
+// Look up a previously recorded subscription. When the request is a replay,
+// the recorded reply is filled in and replayed is true. AccountData is not
+// compared: it is the account's data, which the platform may update between a
+// call and its retry, and it does not change what the subscription is.
+func (self *SubscriptionService) replayCreateSubscription(ctx context.Context, args *api.CreateSubscriptionRequest, reply *api.CreateSubscriptionResponse) (replayed bool, err error) {
+    existing, err := self.store.GetSubscription(ctx, args.SubscriptionId)
+    if err == store.ErrNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    if existing.AccountId != args.AccountId {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription belongs to another account")
+    }
+    if existing.Sku != args.Sku {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription exists with a different SKU")
+    }
+    if existing.Status == store.StatusTerminated {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription is terminated")
+    }
+    log.Info("Replaying CreateSubscription", "subscription-id", args.SubscriptionId)
+    reply.SubscriptionData = existing.SubscriptionData
+    reply.Url = existing.Url
+    reply.Instructions = existing.Instructions
+    return true, nil
+}
+
+// Check an update against the recorded subscription. When the subscription
+// already has the new SKU, the recorded reply is filled in and replayed is true.
+func (self *SubscriptionService) replayUpdateSubscription(ctx context.Context, args *api.UpdateSubscriptionRequest, reply *api.UpdateSubscriptionResponse) (replayed bool, err error) {
+    existing, err := self.store.GetSubscription(ctx, args.SubscriptionId)
+    if err == store.ErrNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    if existing.AccountId != args.AccountId {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription belongs to another account")
+    }
+    if existing.Status == store.StatusTerminated {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription is terminated")
+    }
+    if existing.Sku == args.NewSku && args.OldSku != args.NewSku {
+        log.Info("Replaying UpdateSubscription", "subscription-id", args.SubscriptionId)
+        reply.SubscriptionData = existing.SubscriptionData
+        reply.Url = existing.Url
+        reply.Instructions = existing.Instructions
+        return true, nil
+    }
+    if existing.Sku != args.OldSku {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription has a different SKU")
+    }
+    return false, nil
+}
+
+// Report whether the subscription is already recorded as suspended.
+func (self *SubscriptionService) replaySuspendSubscription(ctx context.Context, args *api.SuspendSubscriptionRequest) (replayed bool, err error) {
+    existing, err := self.existingSubscription(ctx, args.AccountId, args.SubscriptionId)
+    if err != nil || existing == nil {
+        return false, err
+    }
+    if existing.Status == store.StatusSuspended {
+        log.Info("Replaying SuspendSubscription", "subscription-id", args.SubscriptionId)
+        return true, nil
+    }
+    return false, nil
+}
+
+// Report whether the subscription is already recorded as active.
+func (self *SubscriptionService) replayResumeSubscription(ctx context.Context, args *api.ResumeSubscriptionRequest) (replayed bool, err error) {
+    existing, err := self.existingSubscription(ctx, args.AccountId, args.SubscriptionId)
+    if err != nil || existing == nil {
+        return false, err
+    }
+    if existing.Status == store.StatusActive {
+        log.Info("Replaying ResumeSubscription", "subscription-id", args.SubscriptionId)
+        return true, nil
+    }
+    return false, nil
+}
+
+// Look up a live subscription for suspend or resume. Returns nil when no record exists.
+func (self *SubscriptionService) existingSubscription(ctx context.Context, accountId string, subscriptionId string) (*store.Subscription, error) {
+    existing, err := self.store.GetSubscription(ctx, subscriptionId)
+    if err == store.ErrNotFound {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if existing.AccountId != accountId {
+        return nil, errors.ConflictError(subscriptionId, "subscription belongs to another account")
+    }
+    if existing.Status == store.StatusTerminated {
+        return nil, errors.ConflictError(subscriptionId, "subscription is terminated")
+    }
+    return existing, nil
+}
+
+// Report whether the subscription is already recorded as terminated.
+func (self *SubscriptionService) replayTerminateSubscription(ctx context.Context, args *api.TerminateSubscriptionRequest) (replayed bool, err error) {
+    existing, err := self.store.GetSubscription(ctx, args.SubscriptionId)
+    if err == store.ErrNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    if existing.AccountId != args.AccountId {
+        return false, errors.ConflictError(args.SubscriptionId, "subscription belongs to another account")
+    }
+    if existing.Status == store.StatusTerminated {
+        log.Info("Replaying TerminateSubscription", "subscription-id", args.SubscriptionId)
+        return true, nil
+    }
+    return false, nil
+}
+
+// Look up a previously recorded resource. When the request is a replay,
+// the recorded reply is filled in and replayed is true.
+func (self *SubscriptionService) replayCreateResource(ctx context.Context, args *api.CreateResourceRequest, reply *api.CreateResourceResponse) (replayed bool, err error) {
+    existing, err := self.store.GetResource(ctx, args.ResourceId)
+    if err == store.ErrNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    if existing.AccountId != args.AccountId || existing.SubscriptionId != args.SubscriptionId {
+        return false, errors.ConflictError(args.ResourceId, "resource belongs to another subscription")
+    }
+    if existing.Sku != args.Sku {
+        return false, errors.ConflictError(args.ResourceId, "resource exists with a different SKU")
+    }
+    if !sameJson(existing.Configuration, args.Configuration) {
+        return false, errors.ConflictError(args.ResourceId, "resource exists with a different configuration")
+    }
+    if existing.Status == store.StatusTerminated || existing.Status == store.StatusTerminating {
+        return false, errors.ConflictError(args.ResourceId, "resource is terminated")
+    }
+    if existing.Status == store.StatusFailed {
+        // Asynchronous provisioning failed; let the implementation try again.
+        return false, nil
+    }
+    if existing.Status == store.StatusProvisioning {
+        operation, _, ok := self.operations.get(existing.OperationId)
+        if !ok {
+            // The operation was lost, e.g. on restart; let the implementation try again.
+            return false, nil
+        }
+        reply.Operation = operation
+    }
+    log.Info("Replaying CreateResource", "resource-id", args.ResourceId)
+    reply.Url = existing.Url
+    reply.ResourceData = existing.ResourceData
+    reply.Instructions = existing.Instructions
+    return true, nil
+}
+
+// Check an update against the recorded resource. When the resource already
+// has the new name and configuration, the recorded reply is filled in and replayed is true.
+func (self *SubscriptionService) replayUpdateResource(ctx context.Context, args *api.UpdateResourceRequest, reply *api.UpdateResourceResponse) (replayed bool, err error) {
+    existing, err := self.store.GetResource(ctx, args.ResourceId)
+    if err == store.ErrNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    if existing.AccountId != args.AccountId || existing.SubscriptionId != args.SubscriptionId {
+        return false, errors.ConflictError(args.ResourceId, "resource belongs to another subscription")
+    }
+    if existing.Status != store.StatusActive {
+        return false, errors.ConflictError(args.ResourceId, "resource is " + string(existing.Status))
+    }
+    changed := !sameJson(args.PreviousConfiguration, args.Configuration) || args.PreviousResourceName != args.ResourceName
+    if changed && existing.ResourceName == args.ResourceName && sameJson(existing.Configuration, args.Configuration) {
+        log.Info("Replaying UpdateResource", "resource-id", args.ResourceId)
+        reply.Url = existing.Url
+        reply.ResourceData = existing.ResourceData
+        reply.Instructions = existing.Instructions
+        return true, nil
+    }
+    if !sameJson(existing.Configuration, args.PreviousConfiguration) {
+        return false, errors.ConflictError(args.ResourceId, "resource has a different configuration")
+    }
+    return false, nil
+}
+
+// Report whether the resource is already recorded as terminated, or terminating.
+func (self *SubscriptionService) replayTerminateResource(ctx context.Context, args *api.TerminateResourceRequest, reply *api.TerminateResourceResponse) (replayed bool, err error) {
+    existing, err := self.store.GetResource(ctx, args.ResourceId)
+    if err == store.ErrNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    if existing.AccountId != args.AccountId || existing.SubscriptionId != args.SubscriptionId {
+        return false, errors.ConflictError(args.ResourceId, "resource belongs to another subscription")
+    }
+    if existing.Status == store.StatusTerminated {
+        log.Info("Replaying TerminateResource", "resource-id", args.ResourceId)
+        return true, nil
+    }
+    if existing.Status == store.StatusTerminating {
+        if operation, _, ok := self.operations.get(existing.OperationId); ok {
+            log.Info("Replaying TerminateResource", "resource-id", args.ResourceId)
+            reply.Operation = operation
+            return true, nil
+        }
+    }
+    return false, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/auth"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/metric"
+)
+
+var meter = otel.Meter("server")
+
+// Rate, errors and duration of RPCs, by method, SKU and vendor.
+var (
+    rpcRequests, _ = meter.Int64Counter("rpc.server.requests",
+        metric.WithDescription("RPCs completed"))
+    rpcErrors, _ = meter.Int64Counter("rpc.server.errors",
+        metric.WithDescription("RPCs failed, by JSON-RPC error code"))
+    rpcDuration, _ = meter.Float64Histogram("rpc.server.duration",
+        metric.WithDescription("RPC latency"),
+        metric.WithUnit("ms"))
+    rpcActive, _ = meter.Int64UpDownCounter("rpc.server.active_requests",
+        metric.WithDescription("RPCs in flight"))
+)
+
+// The error code reported to the caller. Plain errors are reported as server errors.
+func rpcErrorCode(err error) json2.ErrorCode {
+    if rpcErr, ok := err.(*json2.Error); ok {
+        return rpcErr.Code
+    }
+    return json2.E_SERVER
+}
+
+// Start an RPC: count it in flight, and return its start time for complete.
+func (self *SubscriptionService) begin(method string) time.Time {
+    rpcActive.Add(context.Background(), 1, metric.WithAttributes(attribute.String("rpc.method", method)))
+    return time.Now()
+}
+
+// Record the RED metrics of a completed RPC.
+func (self *SubscriptionService) measure(request *http.Request, method string, args interface{}, start time.Time, err error) {
+    ctx := request.Context()
+    rpcActive.Add(ctx, -1, metric.WithAttributes(attribute.String("rpc.method", method)))
+
+    attributes := []attribute.KeyValue{attribute.String("rpc.method", method)}
+    ids := requestIdsFor(request, args)
+    if ids.NewSku != 0 {
+        attributes = append(attributes, attribute.Int64("subscribed.sku", ids.NewSku))
+    } else if ids.Sku != 0 {
+        attributes = append(attributes, attribute.Int64("subscribed.sku", ids.Sku))
+    }
+    if claims, ok := ctx.Value("claims").(*auth.Claims); ok && claims != nil && claims.Error == nil && claims.VendorId != "" {
+        attributes = append(attributes, attribute.String("subscribed.vendor_id", claims.VendorId))
+    }
+    options := metric.WithAttributes(attributes...)
+
+    rpcRequests.Add(ctx, 1, options)
+    rpcDuration.Record(ctx, float64(time.Since(start).Microseconds()) / 1000, options)
+    if err != nil {
+        code := attribute.Int("rpc.jsonrpc.error_code", int(rpcErrorCode(err)))
+        rpcErrors.Add(ctx, 1, metric.WithAttributes(append(attributes, code)...))
+    }
+}
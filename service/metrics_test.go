@@ -0,0 +1,140 @@
+package service
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/client"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+    "go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Installed once: meters created before the first global provider delegate to
+// it, and ignore providers set later. Values accumulate across tests.
+var testMeterReader = sync.OnceValue(func() *sdkmetric.ManualReader {
+    reader := sdkmetric.NewManualReader()
+    otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+    return reader
+})
+
+type metricKey struct {
+    name string
+    // Encoded attribute set, e.g. "rpc.method=HealthCheck"
+    attributes string
+}
+
+// Current values of counters and gauges, and counts of histograms.
+func collectMetrics(t *testing.T) map[metricKey]float64 {
+    t.Helper()
+    var data metricdata.ResourceMetrics
+    if err := testMeterReader().Collect(context.Background(), &data); err != nil {
+        t.Fatal(err)
+    }
+    values := map[metricKey]float64{}
+    for _, scope := range data.ScopeMetrics {
+        for _, m := range scope.Metrics {
+            switch d := m.Data.(type) {
+            case metricdata.Sum[int64]:
+                for _, point := range d.DataPoints {
+                    values[metricKey{m.Name, point.Attributes.Encoded(attribute.DefaultEncoder())}] = float64(point.Value)
+                }
+            case metricdata.Histogram[float64]:
+                for _, point := range d.DataPoints {
+                    values[metricKey{m.Name, point.Attributes.Encoded(attribute.DefaultEncoder())}] = float64(point.Count)
+                }
+            }
+        }
+    }
+    return values
+}
+
+func key(name string, attributes ...attribute.KeyValue) metricKey {
+    set := attribute.NewSet(attributes...)
+    return metricKey{name, set.Encoded(attribute.DefaultEncoder())}
+}
+
+// Blocks HealthCheck until released.
+type blockingService struct {
+    SubscriptionServiceStub
+    entered chan struct{}
+    release chan struct{}
+}
+
+func (b *blockingService) HealthCheck(request *http.Request, args *api.HealthCheckRequest, reply *api.HealthCheckResponse) error {
+    b.entered <- struct{}{}
+    <-b.release
+    return nil
+}
+
+func TestRpcMetrics(t *testing.T) {
+    testMeterReader()
+    i, url := startTestServer(t, ServerConfig{}, &testService{})
+    ctx := context.Background()
+    before := collectMetrics(t)
+
+    c := newTestClient(t, i, url, issuer.TokenClaims{AccountId: "acct-1"})
+    for _, accountId := range []string{"acct-1", "acct-1", "acct-2"} {
+        c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: accountId, SubscriptionId: "sub-1", Sku: 9101})
+    }
+    // Updates are measured by their target SKU.
+    c.UpdateSubscription(ctx, &api.UpdateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", NewSku: 9102})
+    _, err := client.NewClient(url).CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-2", Sku: 9101})
+    expectCode(t, err, errors.CodeUnauthenticated)
+
+    after := collectMetrics(t)
+    method := attribute.String("rpc.method", "CreateSubscription")
+    sku := attribute.Int64("subscribed.sku", 9101)
+    vendor := attribute.String("subscribed.vendor_id", testVendorId)
+    expected := map[metricKey]float64{
+        key("rpc.server.requests", method, sku, vendor): 3,
+        key("rpc.server.duration", method, sku, vendor): 3,
+        key("rpc.server.errors", method, sku, vendor, attribute.Int("rpc.jsonrpc.error_code", int(errors.CodeAccountScope))): 1,
+        // Failed authentication is measured without a vendor.
+        key("rpc.server.requests", method, sku): 1,
+        key("rpc.server.errors", method, sku, attribute.Int("rpc.jsonrpc.error_code", int(errors.CodeUnauthenticated))): 1,
+        key("rpc.server.requests", attribute.String("rpc.method", "UpdateSubscription"), attribute.Int64("subscribed.sku", 9102), vendor): 1,
+        key("auth.failures", attribute.String("reason", "unauthenticated")): 1,
+    }
+    for k, value := range expected {
+        if delta := after[k] - before[k]; delta != value {
+            t.Errorf("%s{%s} increased by %v, expected %v", k.name, k.attributes, delta, value)
+        }
+    }
+}
+
+func TestActiveRequests(t *testing.T) {
+    testMeterReader()
+    impl := &blockingService{entered: make(chan struct{}), release: make(chan struct{})}
+    i, url := startTestServer(t, ServerConfig{}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    active := key("rpc.server.active_requests", attribute.String("rpc.method", "HealthCheck"))
+
+    done := make(chan error, 1)
+    go func() {
+        _, err := c.HealthCheck(context.Background(), &api.HealthCheckRequest{})
+        done <- err
+    }()
+    select {
+    case <-impl.entered:
+    case <-time.After(5 * time.Second):
+        t.Fatal("HealthCheck not called")
+    }
+    if value := collectMetrics(t)[active]; value != 1 {
+        t.Errorf("%v requests active during a call, expected 1", value)
+    }
+    close(impl.release)
+    if err := <-done; err != nil {
+        t.Fatal(err)
+    }
+    if value := collectMetrics(t)[active]; value != 0 {
+        t.Errorf("%v requests active after the call, expected 0", value)
+    }
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/jupitercloud/subscribed/api"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+)
+
+const (
+    defaultOperationWorkers = 4
+    defaultOperationMaxAttempts = 5
+    defaultOperationRetryDelay = 5 * time.Second
+    // Finished operations remain queryable for this long.
+    operationRetention = 24 * time.Hour
+    operationQueueSize = 256
+)
+
+// Report progress of a running operation.
+type ProgressFunc func(percent int, message string)
+
+// A long-running task, executed by a background worker. The returned result is
+// reported as the operation result, e.g. a *api.CreateResourceResponse.
+// Failed tasks are retried with exponential backoff unless the error is wrapped
+// with Permanent. The context is cancelled on server shutdown.
+type OperationTask func(ctx context.Context, progress ProgressFunc) (interface{}, error)
+
+type permanentError struct {
+    err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Wrap an OperationTask error to fail the operation without further retries.
+func Permanent(err error) error {
+    return &permanentError{err: err}
+}
+
+// Identifies the RPC call an operation belongs to. The wrapper attaches a scope
+// to the request context of methods which support asynchronous operations.
+type operationScope struct {
+    worker *operationWorker
+    method string
+    accountId string
+    subscriptionId string
+    resourceId string
+    // Operation started by the implementation, if any.
+    operation *api.Operation
+    // The started operation, queued by dispatch.
+    pending *operation
+    // Whether a queue slot is reserved for the operation.
+    reserved bool
+}
+
+type operation struct {
+    status api.Operation
+    scope *operationScope
+    task OperationTask
+    link trace.Link
+    finishedAt time.Time
+}
+
+// Runs operations on a fixed pool of goroutines, retrying failed attempts.
+type operationWorker struct {
+    workers int
+    maxAttempts int
+    retryDelay time.Duration
+    // Called once an operation has succeeded or failed.
+    onComplete func(ctx context.Context, status *api.Operation, scope *operationScope)
+
+    mutex sync.Mutex
+    operations map[string]*operation
+    queue chan *operation
+    // Queue slots held for calls in progress, so that dispatch cannot fail.
+    reserved int
+    ctx context.Context
+    cancel context.CancelFunc
+    wg sync.WaitGroup
+}
+
+func newOperationId() string {
+    var buf [16]byte
+    if _, err := rand.Read(buf[:]); err != nil {
+        panic(err)
+    }
+    return hex.EncodeToString(buf[:])
+}
+
+// Start an asynchronous operation from an implementation of CreateResource or
+// TerminateResource. The wrapper returns the pending operation to the platform,
+// which polls GetOperationStatus until it completes. The task is queued only
+// once the implementation returns successfully; if it returns an error, the
+// operation is discarded and never runs.
+func StartOperation(request *http.Request, task OperationTask) (*api.Operation, error) {
+    scope, ok := request.Context().Value("operationScope").(*operationScope)
+    if !ok || scope == nil {
+        return nil, fmt.Errorf("asynchronous operations are not supported by this method")
+    }
+    if scope.operation != nil {
+        return nil, fmt.Errorf("operation already started: %s", scope.operation.OperationId)
+    }
+    scope.pending = &operation{
+        status: api.Operation{
+            OperationId: newOperationId(),
+            Method: scope.method,
+            State: api.OperationStatePending,
+        },
+        scope: scope,
+        task: task,
+        link: trace.LinkFromContext(request.Context()),
+    }
+    status := scope.pending.status
+    scope.operation = &status
+    return &status, nil
+}
+
+// Reserve a queue slot for an operation the implementation may start. Called
+// by the wrapper before the implementation, so a full queue fails the call
+// before the implementation has acted on it.
+func (scope *operationScope) reserve() error {
+    w := scope.worker
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if len(w.queue) + w.reserved >= cap(w.queue) {
+        return fmt.Errorf("operation queue is full")
+    }
+    w.reserved++
+    scope.reserved = true
+    return nil
+}
+
+// Queue the operation started by the implementation, if any, into the reserved
+// slot. Called by the wrapper after the implementation returned successfully.
+func (scope *operationScope) dispatch() {
+    w := scope.worker
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if scope.reserved {
+        w.reserved--
+        scope.reserved = false
+    }
+    op := scope.pending
+    if op == nil {
+        return
+    }
+    w.prune()
+    w.queue <- op
+    w.operations[op.status.OperationId] = op
+    log.Info("Operation queued", "operation-id", op.status.OperationId, "method", op.scope.method)
+}
+
+// Release the reserved slot if it is still held, so an operation started by
+// a failed implementation is discarded. Deferred by the wrapper.
+func (scope *operationScope) discard() {
+    w := scope.worker
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if scope.reserved {
+        w.reserved--
+        scope.reserved = false
+    }
+}
+
+// Remove finished operations past retention. Caller holds the mutex.
+func (w *operationWorker) prune() {
+    cutoff := time.Now().Add(-operationRetention)
+    for id, op := range w.operations {
+        if !op.finishedAt.IsZero() && op.finishedAt.Before(cutoff) {
+            delete(w.operations, id)
+        }
+    }
+}
+
+// Fetch a snapshot of an operation, and the account which owns it.
+func (w *operationWorker) get(operationId string) (*api.Operation, string, bool) {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    op, ok := w.operations[operationId]
+    if !ok {
+        return nil, "", false
+    }
+    status := op.status
+    return &status, op.scope.accountId, true
+}
+
+func (w *operationWorker) update(op *operation, fn func(status *api.Operation)) {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    fn(&op.status)
+}
+
+func (w *operationWorker) run(op *operation) {
+    ctx, span := tracer.Start(w.ctx, "Operation " + op.scope.method, trace.WithLinks(op.link))
+    defer span.End()
+    span.SetAttributes(
+        attribute.String("operation.operation_id", op.status.OperationId),
+        attribute.String("operation.account_id", op.scope.accountId),
+        attribute.String("operation.resource_id", op.scope.resourceId),
+    )
+
+    progress := func(percent int, message string) {
+        w.update(op, func(status *api.Operation) {
+            status.Progress = percent
+            status.Message = message
+        })
+    }
+
+    delay := w.retryDelay
+    for attempt := 1; ; attempt++ {
+        w.update(op, func(status *api.Operation) {
+            status.State = api.OperationStateRunning
+            status.Attempts = attempt
+        })
+
+        result, err := op.task(ctx, progress)
+        if err == nil {
+            log.Info("Operation succeeded", "operation-id", op.status.OperationId, "attempts", attempt)
+            w.update(op, func(status *api.Operation) {
+                status.State = api.OperationStateSucceeded
+                status.Progress = 100
+                status.Error = ""
+                status.Result = result
+            })
+            span.SetStatus(codes.Ok, codes.Ok.String())
+            break
+        }
+
+        span.RecordError(err)
+        w.update(op, func(status *api.Operation) {
+            status.Error = err.Error()
+        })
+        _, permanent := err.(*permanentError)
+        if permanent || attempt >= w.maxAttempts || ctx.Err() != nil {
+            log.Error("Operation failed", "operation-id", op.status.OperationId, "attempts", attempt, "error", err)
+            w.update(op, func(status *api.Operation) {
+                status.State = api.OperationStateFailed
+            })
+            span.SetStatus(codes.Error, err.Error())
+            break
+        }
+
+        log.Warn("Operation attempt failed, retrying", "operation-id", op.status.OperationId, "attempt", attempt, "delay", delay, "error", err)
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+        }
+        delay *= 2
+    }
+
+    w.mutex.Lock()
+    op.finishedAt = time.Now()
+    status := op.status
+    w.mutex.Unlock()
+
+    if w.onComplete != nil {
+        w.onComplete(context.WithoutCancel(ctx), &status, op.scope)
+    }
+}
+
+func (w *operationWorker) Initialize(ctx context.Context) error {
+    log.Info("Starting operation workers", "workers", w.workers)
+    w.ctx, w.cancel = context.WithCancel(context.Background())
+    for i := 0; i < w.workers; i++ {
+        w.wg.Add(1)
+        go func() {
+            defer w.wg.Done()
+            for {
+                select {
+                case op := <-w.queue:
+                    w.run(op)
+                case <-w.ctx.Done():
+                    return
+                }
+            }
+        }()
+    }
+    return nil
+}
+
+func (w *operationWorker) Shutdown(ctx context.Context) error {
+    log.Debug("Shutting down operation workers")
+    w.cancel()
+    w.wg.Wait()
+    if pending := len(w.queue); pending > 0 {
+        log.Warn("Abandoned queued operations", "count", pending)
+    }
+    return nil
+}
+
+func newOperationWorker(workers int, maxAttempts int) *operationWorker {
+    if workers <= 0 {
+        workers = defaultOperationWorkers
+    }
+    if maxAttempts <= 0 {
+        maxAttempts = defaultOperationMaxAttempts
+    }
+    return &operationWorker{
+        workers: workers,
+        maxAttempts: maxAttempts,
+        retryDelay: defaultOperationRetryDelay,
+        operations: make(map[string]*operation),
+        queue: make(chan *operation, operationQueueSize),
+    }
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+    "testing"
+)
+
+func TestOperationQueueReservation(t *testing.T) {
+    worker := newOperationWorker(1, 1)
+    var scopes []*operationScope
+    for i := 0; i < operationQueueSize; i++ {
+        scope := &operationScope{worker: worker, method: "CreateResource"}
+        if err := scope.reserve(); err != nil {
+            t.Fatalf("reservation %d: %v", i, err)
+        }
+        scopes = append(scopes, scope)
+    }
+    full := &operationScope{worker: worker, method: "CreateResource"}
+    if err := full.reserve(); err == nil {
+        t.Fatal("expected a full queue to refuse a reservation")
+    }
+
+    // Discarding a call frees its slot; discarding twice frees nothing more.
+    scopes[0].discard()
+    scopes[0].discard()
+    if err := full.reserve(); err != nil {
+        t.Fatal(err)
+    }
+    if err := (&operationScope{worker: worker}).reserve(); err == nil {
+        t.Fatal("expected the freed slot to be taken")
+    }
+
+    // Dispatching into reserved slots never fails, even with the queue full.
+    for _, scope := range append(scopes[1:], full) {
+        scope.pending = &operation{scope: scope}
+        scope.pending.status.OperationId = newOperationId()
+        scope.dispatch()
+        scope.discard()
+    }
+    if queued := len(worker.queue); queued != operationQueueSize {
+        t.Fatalf("%d operations queued, expected %d", queued, operationQueueSize)
+    }
+    if worker.reserved != 0 {
+        t.Fatalf("%d slots still reserved", worker.reserved)
+    }
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+    "context"
+    "time"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/store"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// Entitlement records are written after the implementation has succeeded.
+// A failure to record is logged but not returned, since the vendor-side
+// provisioning has already taken place.
+func recordFailed(ctx context.Context, kind string, id string, err error) {
+    log.Error("Failed to record entitlement", "kind", kind, "id", id, "error", err)
+    trace.SpanFromContext(ctx).RecordError(err)
+}
+
+func (self *SubscriptionService) recordOpenAccount(ctx context.Context, args *api.OpenAccountRequest, reply *api.OpenAccountResponse) {
+    now := time.Now().UTC()
+    account := &store.Account{
+        AccountId: args.AccountId,
+        Name: args.Name,
+        Addresses: args.Addresses,
+        AccountData: reply.AccountData,
+        Status: store.StatusActive,
+        CreatedAt: now,
+        UpdatedAt: now,
+    }
+    if existing, err := self.store.GetAccount(ctx, args.AccountId); err == nil {
+        account.CreatedAt = existing.CreatedAt
+    }
+    if err := self.store.PutAccount(ctx, account); err != nil {
+        recordFailed(ctx, "account", args.AccountId, err)
+    }
+}
+
+func (self *SubscriptionService) recordCloseAccount(ctx context.Context, args *api.CloseAccountRequest) {
+    now := time.Now().UTC()
+    account, err := self.store.GetAccount(ctx, args.AccountId)
+    if err != nil {
+        account = &store.Account{AccountId: args.AccountId, AccountData: args.AccountData, CreatedAt: now}
+    }
+    account.Status = store.StatusTerminated
+    account.UpdatedAt = now
+    if err := self.store.PutAccount(ctx, account); err != nil {
+        recordFailed(ctx, "account", args.AccountId, err)
+    }
+}
+
+func (self *SubscriptionService) recordCreateSubscription(ctx context.Context, args *api.CreateSubscriptionRequest, reply *api.CreateSubscriptionResponse) {
+    now := time.Now().UTC()
+    subscription := &store.Subscription{
+        AccountId: args.AccountId,
+        SubscriptionId: args.SubscriptionId,
+        Sku: args.Sku,
+        SubscriptionData: reply.SubscriptionData,
+        Url: reply.Url,
+        Instructions: reply.Instructions,
+        Status: store.StatusActive,
+        CreatedAt: now,
+        UpdatedAt: now,
+    }
+    if err := self.store.PutSubscription(ctx, subscription); err != nil {
+        recordFailed(ctx, "subscription", args.SubscriptionId, err)
+    }
+}
+
+func (self *SubscriptionService) recordUpdateSubscription(ctx context.Context, args *api.UpdateSubscriptionRequest, reply *api.UpdateSubscriptionResponse) {
+    now := time.Now().UTC()
+    subscription, err := self.store.GetSubscription(ctx, args.SubscriptionId)
+    if err != nil {
+        subscription = &store.Subscription{
+            AccountId: args.AccountId,
+            SubscriptionId: args.SubscriptionId,
+            SubscriptionData: args.SubscriptionData,
+            Status: store.StatusActive,
+            CreatedAt: now,
+        }
+    }
+    subscription.Sku = args.NewSku
+    if reply.SubscriptionData != nil {
+        subscription.SubscriptionData = reply.SubscriptionData
+    }
+    if reply.Url != "" {
+        subscription.Url = reply.Url
+    }
+    if reply.Instructions.Content != "" {
+        subscription.Instructions = reply.Instructions
+    }
+    subscription.UpdatedAt = now
+    if err := self.store.PutSubscription(ctx, subscription); err != nil {
+        recordFailed(ctx, "subscription", args.SubscriptionId, err)
+    }
+}
+
+func (self *SubscriptionService) recordSuspendSubscription(ctx context.Context, args *api.SuspendSubscriptionRequest) {
+    self.recordSubscriptionStatus(ctx, args.AccountId, args.SubscriptionId, args.Sku, args.SubscriptionData, store.StatusSuspended, args.Reason)
+}
+
+func (self *SubscriptionService) recordResumeSubscription(ctx context.Context, args *api.ResumeSubscriptionRequest) {
+    self.recordSubscriptionStatus(ctx, args.AccountId, args.SubscriptionId, args.Sku, args.SubscriptionData, store.StatusActive, "")
+}
+
+func (self *SubscriptionService) recordSubscriptionStatus(ctx context.Context, accountId string, subscriptionId string, sku int64, data api.Metadata, status store.Status, reason string) {
+    now := time.Now().UTC()
+    subscription, err := self.store.GetSubscription(ctx, subscriptionId)
+    if err != nil {
+        subscription = &store.Subscription{
+            AccountId: accountId,
+            SubscriptionId: subscriptionId,
+            Sku: sku,
+            SubscriptionData: data,
+            CreatedAt: now,
+        }
+    }
+    subscription.Status = status
+    subscription.SuspendReason = reason
+    subscription.UpdatedAt = now
+    if err := self.store.PutSubscription(ctx, subscription); err != nil {
+        recordFailed(ctx, "subscription", subscriptionId, err)
+    }
+}
+
+func (self *SubscriptionService) recordTerminateSubscription(ctx context.Context, args *api.TerminateSubscriptionRequest) {
+    now := time.Now().UTC()
+    subscription, err := self.store.GetSubscription(ctx, args.SubscriptionId)
+    if err != nil {
+        subscription = &store.Subscription{
+            AccountId: args.AccountId,
+            SubscriptionId: args.SubscriptionId,
+            Sku: args.Sku,
+            SubscriptionData: args.SubscriptionData,
+            CreatedAt: now,
+        }
+    }
+    subscription.Status = store.StatusTerminated
+    subscription.UpdatedAt = now
+    if err := self.store.PutSubscription(ctx, subscription); err != nil {
+        recordFailed(ctx, "subscription", args.SubscriptionId, err)
+    }
+}
+
+func (self *SubscriptionService) recordCreateResource(ctx context.Context, args *api.CreateResourceRequest, reply *api.CreateResourceResponse) {
+    now := time.Now().UTC()
+    resource := &store.Resource{
+        AccountId: args.AccountId,
+        SubscriptionId: args.SubscriptionId,
+        ResourceId: args.ResourceId,
+        Sku: args.Sku,
+        ResourceName: args.ResourceName,
+        Configuration: args.Configuration,
+        ResourceData: reply.ResourceData,
+        Url: reply.Url,
+        Instructions: reply.Instructions,
+        Status: store.StatusActive,
+        CreatedAt: now,
+        UpdatedAt: now,
+    }
+    if reply.Operation != nil {
+        resource.Status = store.StatusProvisioning
+        resource.OperationId = reply.Operation.OperationId
+    }
+    if err := self.store.PutResource(ctx, resource); err != nil {
+        recordFailed(ctx, "resource", args.ResourceId, err)
+    }
+}
+
+func (self *SubscriptionService) recordUpdateResource(ctx context.Context, args *api.UpdateResourceRequest, reply *api.UpdateResourceResponse) {
+    now := time.Now().UTC()
+    resource, err := self.store.GetResource(ctx, args.ResourceId)
+    if err != nil {
+        resource = &store.Resource{
+            AccountId: args.AccountId,
+            SubscriptionId: args.SubscriptionId,
+            ResourceId: args.ResourceId,
+            Sku: args.Sku,
+            ResourceData: args.ResourceData,
+            Status: store.StatusActive,
+            CreatedAt: now,
+        }
+    }
+    resource.ResourceName = args.ResourceName
+    resource.Configuration = args.Configuration
+    if reply.ResourceData != nil {
+        resource.ResourceData = reply.ResourceData
+    }
+    if reply.Url != "" {
+        resource.Url = reply.Url
+    }
+    if reply.Instructions.Content != "" {
+        resource.Instructions = reply.Instructions
+    }
+    resource.UpdatedAt = now
+    if err := self.store.PutResource(ctx, resource); err != nil {
+        recordFailed(ctx, "resource", args.ResourceId, err)
+    }
+}
+
+func (self *SubscriptionService) recordTerminateResource(ctx context.Context, args *api.TerminateResourceRequest, reply *api.TerminateResourceResponse) {
+    now := time.Now().UTC()
+    resource, err := self.store.GetResource(ctx, args.ResourceId)
+    if err != nil {
+        resource = &store.Resource{
+            AccountId: args.AccountId,
+            SubscriptionId: args.SubscriptionId,
+            ResourceId: args.ResourceId,
+            Sku: args.Sku,
+            ResourceName: args.ResourceName,
+            ResourceData: args.ResourceData,
+            CreatedAt: now,
+        }
+    }
+    // A synchronous termination supersedes any operation in progress.
+    resource.Status = store.StatusTerminated
+    resource.OperationId = ""
+    resource.UpdatedAt = now
+    if reply.Operation != nil {
+        resource.Status = store.StatusTerminating
+        resource.OperationId = reply.Operation.OperationId
+    }
+    if err := self.store.PutResource(ctx, resource); err != nil {
+        recordFailed(ctx, "resource", args.ResourceId, err)
+    }
+}
+
+// Record the outcome of an asynchronous resource operation. Holds the resource
+// ID lock, so the outcome is recorded after the call which started the
+// operation, and cannot interleave with a later call on the same resource.
+func (self *SubscriptionService) recordOperation(ctx context.Context, status *api.Operation, scope *operationScope) {
+    unlock := self.locker.lock(scope.resourceId)
+    defer unlock()
+
+    resource, err := self.store.GetResource(ctx, scope.resourceId)
+    if err != nil {
+        recordFailed(ctx, "resource", scope.resourceId, err)
+        return
+    }
+    if resource.OperationId != status.OperationId {
+        log.Warn("Ignoring outcome of superseded operation", "operation-id", status.OperationId, "resource-id", scope.resourceId)
+        return
+    }
+    if resource.Status == store.StatusTerminated {
+        log.Warn("Ignoring outcome of operation on terminated resource", "operation-id", status.OperationId, "resource-id", scope.resourceId)
+        return
+    }
+
+    succeeded := status.State == api.OperationStateSucceeded
+    switch scope.method {
+    case "CreateResource":
+        if !succeeded {
+            resource.Status = store.StatusFailed
+            break
+        }
+        resource.Status = store.StatusActive
+        if reply, ok := status.Result.(*api.CreateResourceResponse); ok && reply != nil {
+            resource.Url = reply.Url
+            resource.ResourceData = reply.ResourceData
+            resource.Instructions = reply.Instructions
+        }
+    case "TerminateResource":
+        if succeeded {
+            resource.Status = store.StatusTerminated
+        } else {
+            resource.Status = store.StatusActive
+        }
+    }
+    resource.UpdatedAt = time.Now().UTC()
+    if err := self.store.PutResource(ctx, resource); err != nil {
+        recordFailed(ctx, "resource", scope.resourceId, err)
+    }
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "strings"
+    "testing"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/client"
+)
+
+// Account names, addresses and dev tokens reach neither logs nor spans.
+func TestRedaction(t *testing.T) {
+    read := captureLogs(t)
+    recorder := recordTraces(t)
+    _, url := startTestServer(t, ServerConfig{Dev: true}, &testService{})
+    c := client.NewClient(url)
+    c.SetToken(`{"https://jupitercloud.com/vendorId":"` + testVendorId + `","sub":"dev","note":"dev-token-marker"}`)
+
+    _, err := c.OpenAccount(context.Background(), &api.OpenAccountRequest{
+        AccountId: "acct-1",
+        Name: "Ada Lovelace",
+        Addresses: []api.Address{{AddressId: "addr-1", Line1: "12 St James's Square", Country: "GB"}},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    waitForAccessLog(t, read, 1)
+
+    var request string
+    for _, span := range recorder.Ended() {
+        for _, attr := range span.Attributes() {
+            if attr.Key == "rpc.request" {
+                request = attr.Value.AsString()
+            }
+        }
+    }
+    if !strings.Contains(request, `"accountId":"acct-1"`) || !strings.Contains(request, `"name":"[REDACTED]"`) {
+        t.Errorf("rpc.request span attribute %s", request)
+    }
+    var logged []string
+    for _, line := range read("service") {
+        if line["@message"] == "RPC arguments" {
+            args, _ := json.Marshal(line["args"])
+            logged = append(logged, string(args))
+        }
+    }
+    if len(logged) != 1 || !strings.Contains(logged[0], `"name":"[REDACTED]"`) {
+        t.Errorf("logged arguments %q", logged)
+    }
+
+    all, err := json.Marshal(read(""))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, secret := range []string{"Ada Lovelace", "St James", "dev-token-marker"} {
+        if strings.Contains(string(all), secret) || strings.Contains(request, secret) {
+            t.Errorf("%q leaked", secret)
+        }
+    }
+}
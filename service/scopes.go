@@ -0,0 +1,47 @@
+package service
+
+import (
+    "github.com/jupitercloud/subscribed/auth"
+    "github.com/jupitercloud/subscribed/errors"
+)
+
+// Token scopes granting access to groups of methods.
+const (
+    ScopeAccountWrite = "account:write"
+    ScopeProvisionRead = "provision:read"
+    ScopeProvisionWrite = "provision:write"
+    ScopeUsageRead = "usage:read"
+)
+
+// Maps RPC method names, e.g. "CloseAccount", to the scopes a token must carry
+// to call them. Methods not in the policy require no scope.
+type ScopePolicy map[string][]string
+
+// Policy for the methods of api.SubscriptionServiceInterface. HealthCheck and
+// GetCatalog are open to any valid token.
+var DefaultScopePolicy = ScopePolicy{
+    "OpenAccount": {ScopeAccountWrite},
+    "CloseAccount": {ScopeAccountWrite},
+    "CreateSubscription": {ScopeProvisionWrite},
+    "UpdateSubscription": {ScopeProvisionWrite},
+    "SuspendSubscription": {ScopeProvisionWrite},
+    "ResumeSubscription": {ScopeProvisionWrite},
+    "TerminateSubscription": {ScopeProvisionWrite},
+    "CreateResource": {ScopeProvisionWrite},
+    "UpdateResource": {ScopeProvisionWrite},
+    "TerminateResource": {ScopeProvisionWrite},
+    "GetOperationStatus": {ScopeProvisionRead},
+    "GetSubscriptionUsage": {ScopeUsageRead},
+}
+
+// Fail with a forbidden error unless claims carry every scope method requires.
+// A nil policy allows every method.
+func (policy ScopePolicy) authorize(method string, claims *auth.Claims) error {
+    for _, scope := range policy[method] {
+        if !claims.HasScope(scope) {
+            log.Warn("Token missing required scope", "method", method, "scope", scope)
+            return errors.ForbiddenError(method, scope)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+    "context"
+    "testing"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+func TestScopePolicy(t *testing.T) {
+    i, url := startTestServer(t, ServerConfig{ScopePolicy: DefaultScopePolicy}, &testService{})
+    ctx := context.Background()
+    create := &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}
+
+    unscoped := newTestClient(t, i, url, issuer.TokenClaims{})
+    _, err := unscoped.CreateSubscription(ctx, create)
+    expectCode(t, err, errors.CodeForbidden)
+    data, _ := err.(*json2.Error).Data.(map[string]interface{})
+    if data["scope"] != ScopeProvisionWrite {
+        t.Errorf("forbidden error names scope %v", data["scope"])
+    }
+    // Methods outside the policy need no scope.
+    if _, err := unscoped.HealthCheck(ctx, &api.HealthCheckRequest{}); err != nil {
+        t.Fatal(err)
+    }
+
+    writer := newTestClient(t, i, url, issuer.TokenClaims{Scopes: []string{ScopeProvisionWrite}})
+    if _, err := writer.CreateSubscription(ctx, create); err != nil {
+        t.Fatal(err)
+    }
+    _, err = writer.GetSubscriptionUsage(ctx, &api.GetSubscriptionUsageRequest{AccountId: "acct-1", SubscriptionId: "sub-1"})
+    expectCode(t, err, errors.CodeForbidden)
+
+    // Scopes may also be minted as an array.
+    reader := newTestClient(t, i, url, issuer.TokenClaims{Extra: map[string]interface{}{"scope": []string{ScopeUsageRead}}})
+    if _, err := reader.GetSubscriptionUsage(ctx, &api.GetSubscriptionUsageRequest{AccountId: "acct-1", SubscriptionId: "sub-1"}); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestNoScopePolicy(t *testing.T) {
+    i, url := startTestServer(t, ServerConfig{}, &testService{})
+    unscoped := newTestClient(t, i, url, issuer.TokenClaims{})
+    if _, err := unscoped.CreateSubscription(context.Background(), &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+}
@@ -5,14 +5,23 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	rpc "github.com/gorilla/rpc/v2"
 	"github.com/gorilla/rpc/v2/json2"
 	"github.com/jupitercloud/subscribed/api"
+	"github.com/jupitercloud/subscribed/audit"
 	"github.com/jupitercloud/subscribed/auth"
+	"github.com/jupitercloud/subscribed/catalog"
+	"github.com/jupitercloud/subscribed/logger"
+	"github.com/jupitercloud/subscribed/schema"
+	"github.com/jupitercloud/subscribed/store"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -31,6 +40,83 @@ type ServerConfig struct {
     VendorId string
     // Development mode - authorization is disabled.
     Dev bool
+    // Optional JWKS or PEM public key file verifying tokens, instead of OIDC discovery.
+    KeyFile string
+    // Interval between checks of KeyFile for rotated keys. Defaults to one minute.
+    KeyReloadInterval time.Duration
+    // Accepted token audiences. When set, tokens must name one of them in the aud claim.
+    Audiences []string
+    // Allowed clock skew between this server and the issuer, applied to exp, nbf and iat.
+    // Defaults to auth.DefaultClockSkew; a negative value checks without leeway.
+    ClockSkew time.Duration
+    // Maximum time since a token was issued. Zero accepts any token until it expires.
+    MaxTokenAge time.Duration
+    // Required azp (authorized party) claim. Empty accepts any.
+    AuthorizedParty string
+    // TLS certificate and key files. When set, the server listens with TLS only.
+    TLSCertFile string
+    TLSKeyFile string
+    // Interval between checks of the TLS files for a renewed certificate. Defaults to one minute.
+    TLSReloadInterval time.Duration
+    // CA certificates verifying TLS client certificates. Enables mutual TLS.
+    ClientCAFile string
+    // How a client certificate combines with the token: auth.ClientCertAndToken
+    // (the default with ClientCAFile) or auth.ClientCertOrToken.
+    ClientCertMode string
+    // Certificate common names, DNS or URI SANs accepted without a token with
+    // auth.ClientCertOrToken. Required in that mode.
+    ClientCertSubjects []string
+    // Scopes granted to callers authenticated by certificate alone, checked
+    // against ScopePolicy like token scopes.
+    ClientCertScopes []string
+    // Optional address serving admin endpoints, e.g. "localhost:8082". Must not be
+    // exposed publicly. GET or PUT /log-levels reads or changes log levels at runtime.
+    AdminAddress string
+    // Bearer token required by admin endpoints. Required unless AdminAddress is a
+    // loopback address.
+    AdminToken string
+    // Optional handler serving metrics at /metrics, e.g. telemetry.MetricsHandler().
+    // Served only on AdminAddress, which is required when set.
+    MetricsHandler http.Handler
+    // Optional tamper-evident log of every RPC, shared by all hosted vendors.
+    AuditLog *audit.Log
+    // Entitlement store recording provisioned accounts, subscriptions and resources,
+    // and backing idempotent retries. Defaults to an in-memory store, logging a warning.
+    Store store.Store
+    // Number of background workers running asynchronous operations. Defaults to 4.
+    OperationWorkers int
+    // Attempts made at an asynchronous operation before it fails. Defaults to 5.
+    OperationMaxAttempts int
+    // Optional per-SKU JSON Schemas. When set, resource Configuration is validated
+    // before the implementation is called, and SKUs without a schema are rejected.
+    Schemas *schema.Registry
+    // Optional catalog of supported SKUs, published through GetCatalog. When set,
+    // unknown SKUs are rejected and resource Configuration is validated against
+    // the SKU's configuration schema.
+    Catalog *catalog.Catalog
+    // Optional scopes required by each method, e.g. DefaultScopePolicy. When nil,
+    // token scopes are not checked.
+    ScopePolicy ScopePolicy
+    // Optional cache of seen token IDs, e.g. auth.NewMemoryReplayCache. When set,
+    // a token's jti may be used for only one request to ReplayProtectedMethods;
+    // retries of that request are let through to the idempotency checks.
+    ReplayCache auth.ReplayCache
+    // Methods rejecting a reused token. Defaults to DefaultReplayProtectedMethods.
+    ReplayProtectedMethods []string
+}
+
+// Methods which change accounts, subscriptions or resources.
+var DefaultReplayProtectedMethods = []string{
+    "OpenAccount",
+    "CloseAccount",
+    "CreateSubscription",
+    "UpdateSubscription",
+    "SuspendSubscription",
+    "ResumeSubscription",
+    "TerminateSubscription",
+    "CreateResource",
+    "UpdateResource",
+    "TerminateResource",
 }
 
 func CorsHandler(response http.ResponseWriter, request *http.Request) {
@@ -64,6 +150,9 @@ func httpTraceMiddleware(next http.Handler) http.Handler {
 func rpcHookBefore(info *rpc.RequestInfo) *http.Request {
     ctx1, span := tracer.Start(info.Request.Context(), "RPC " + info.Method)
     ctx2 := context.WithValue(ctx1, "rpcSpan", span)
+    if entry := accessEntryFromContext(ctx1); entry != nil {
+        entry.span = span.SpanContext()
+    }
     span.SetAttributes(
         attribute.String("rpc.system", "json_rpc"),
         attribute.String("rpc.method", info.Method),
@@ -80,22 +169,131 @@ func rpcHookBefore(info *rpc.RequestInfo) *http.Request {
 func rpcHookAfter(info *rpc.RequestInfo) {
     span := info.Request.Context().Value("rpcSpan").(trace.Span)
     span.End()
+    if entry := accessEntryFromContext(info.Request.Context()); entry != nil {
+        entry.dispatched = true
+        if info.Error != nil {
+            // Plain errors are reported to the caller as server errors.
+            entry.errorCode = json2.E_SERVER
+            if rpcErr, ok := info.Error.(*json2.Error); ok {
+                entry.errorCode = rpcErr.Code
+            }
+        }
+    }
+}
+
+// Whether address, e.g. "localhost:8082", only listens on a loopback interface.
+func isLoopbackAddress(address string) bool {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return false
+    }
+    if host == "localhost" {
+        return true
+    }
+    ip := net.ParseIP(host)
+    return ip != nil && ip.IsLoopback()
+}
+
+// Require "Authorization: Bearer <token>" when token is set.
+func adminAuthMiddleware(token string, next http.Handler) http.Handler {
+    if token == "" {
+        return next
+    }
+    expected := []byte("Bearer " + token)
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), expected) != 1 {
+            http.Error(response, "unauthorized", http.StatusUnauthorized)
+            return
+        }
+        next.ServeHTTP(response, request)
+    })
+}
+
+// Serve admin endpoints on a separate listener, so they are not exposed with the RPC endpoint.
+func startAdminServer(address string, token string, metrics http.Handler) *http.Server {
+    r := http.NewServeMux()
+    r.Handle("/log-levels", logger.LevelHandler())
+    if metrics != nil {
+        r.Handle("/metrics", metrics)
+    }
+    admin := &http.Server{Addr: address, Handler: adminAuthMiddleware(token, r)}
+    go func() {
+        log.Info("Launching admin server", "address", address)
+        err := admin.ListenAndServe()
+        if err != nil && err != http.ErrServerClosed {
+            log.Error("Failed to launch admin server", "error", err)
+        }
+    }()
+    return admin
 }
 
 // Run a server, exiting on the quit signal. This function returns an error
 // on failure to launch the server, otherwise blocks until the server exits.
 func RunServer(config ServerConfig, impl api.SubscriptionServiceInterface, quit chan os.Signal) error {
-    svc := createSubscriptionService(impl)
-    // Create a new RPC server
-    s := rpc.NewServer()
-    // Register the type of data requested as JSON
-    s.RegisterCodec(json2.NewCodec(), "application/json")
-    // Register the service by creating a new JSON server
-    s.RegisterService(svc, "")
-    s.RegisterInterceptFunc(rpcHookBefore)
-    s.RegisterAfterFunc(rpcHookAfter)
-
-    auth := auth.NewAuthService(config.Issuer, config.VendorId, config.Dev)
+    vendors := map[string]Vendor{
+        config.VendorId: {
+            Impl: impl,
+            Store: config.Store,
+            Schemas: config.Schemas,
+            Catalog: config.Catalog,
+        },
+    }
+    return RunMultiVendorServer(config, vendors, quit)
+}
+
+// Run a server hosting several vendors, exiting on the quit signal. RPCs are
+// routed by the token's vendorId claim, or served at /vendors/{vendorId}/rpc.
+// The VendorId, Store, Schemas and Catalog settings of config are ignored in
+// favour of each Vendor's.
+func RunMultiVendorServer(config ServerConfig, vendors map[string]Vendor, quit chan os.Signal) error {
+    if len(vendors) == 0 {
+        return fmt.Errorf("no vendors configured")
+    }
+    vendorServers := make(map[string]*vendorServer)
+    var vendorIds []string
+    for vendorId, vendor := range vendors {
+        vendorServers[vendorId] = newVendorServer(vendorId, vendor, config)
+        vendorIds = append(vendorIds, vendorId)
+    }
+    replayProtectedMethods := config.ReplayProtectedMethods
+    if replayProtectedMethods == nil {
+        replayProtectedMethods = DefaultReplayProtectedMethods
+    }
+    if config.MetricsHandler != nil && config.AdminAddress == "" {
+        return fmt.Errorf("metrics handler requires an admin address")
+    }
+    if config.AdminAddress != "" && config.AdminToken == "" && !isLoopbackAddress(config.AdminAddress) {
+        return fmt.Errorf("admin address %s is not a loopback address and requires an admin token", config.AdminAddress)
+    }
+    if config.ClientCAFile != "" && (config.TLSCertFile == "" || config.TLSKeyFile == "") {
+        return fmt.Errorf("client CA file requires a TLS certificate and key")
+    }
+    clientCertMode := ""
+    if config.ClientCAFile != "" {
+        clientCertMode = config.ClientCertMode
+        if clientCertMode == "" {
+            clientCertMode = auth.ClientCertAndToken
+        }
+        if clientCertMode == auth.ClientCertOrToken && len(config.ClientCertSubjects) == 0 {
+            return fmt.Errorf("client certificate mode %s requires client certificate subjects", clientCertMode)
+        }
+    }
+    auth := auth.NewAuthService(auth.Config{
+        Issuer: config.Issuer,
+        VendorIds: vendorIds,
+        DevMode: config.Dev,
+        KeyFile: config.KeyFile,
+        KeyReloadInterval: config.KeyReloadInterval,
+        Audiences: config.Audiences,
+        ClockSkew: config.ClockSkew,
+        MaxTokenAge: config.MaxTokenAge,
+        AuthorizedParty: config.AuthorizedParty,
+        ReplayCache: config.ReplayCache,
+        ReplayProtectedMethods: replayProtectedMethods,
+        ClientCertMode: clientCertMode,
+        ClientCertSubjects: config.ClientCertSubjects,
+        ClientCertScopes: config.ClientCertScopes,
+    })
     err := auth.Initialize(context.Background())
     if (err != nil) {
         log.Error("Failed to initialize authorization")
@@ -104,31 +302,78 @@ func RunServer(config ServerConfig, impl api.SubscriptionServiceInterface, quit
 
     defer auth.Shutdown(context.Background())
 
-    err = impl.Initialize(context.Background())
-    if (err != nil) {
-        log.Error("Failed to initialize service")
-        return err
+    if config.AuditLog != nil {
+        err = config.AuditLog.Initialize(context.Background())
+        if (err != nil) {
+            log.Error("Failed to initialize audit log")
+            return err
+        }
+
+        defer config.AuditLog.Shutdown(context.Background())
     }
 
-    defer impl.Shutdown(context.Background())
+    for _, vendor := range vendorServers {
+        err = vendor.Initialize(context.Background())
+        if (err != nil) {
+            return err
+        }
+
+        defer vendor.Shutdown(context.Background())
+    }
 
     r := mux.NewRouter()
     r.Use(otelmux.Middleware("subscribed"))
     r.Use(httpTraceMiddleware)
     r.Use(corsMiddleware)
+    r.Use(requestIdMiddleware)
     r.Use(auth.Middleware)
+    router := newVendorRouter(vendorServers)
     r.HandleFunc("/rpc", CorsHandler).Methods("OPTIONS")
-    r.Handle("/rpc", s)
+    r.Handle("/rpc", accessLogMiddleware(auditRejectedMiddleware(config.AuditLog, http.HandlerFunc(router.serveClaimed))))
+    r.HandleFunc("/vendors/{vendorId}/rpc", CorsHandler).Methods("OPTIONS")
+    r.Handle("/vendors/{vendorId}/rpc", accessLogMiddleware(auditRejectedMiddleware(config.AuditLog, http.HandlerFunc(router.serveVendorPath))))
+    r.HandleFunc("/healthz", func(response http.ResponseWriter, request *http.Request) {
+        response.WriteHeader(http.StatusOK)
+    }).Methods("GET")
+    // Not ready until the token issuer's keys are available.
+    r.HandleFunc("/readyz", func(response http.ResponseWriter, request *http.Request) {
+        if !auth.Ready() {
+            http.Error(response, "authorization not ready", http.StatusServiceUnavailable)
+            return
+        }
+        response.WriteHeader(http.StatusOK)
+    }).Methods("GET")
 
     server := &http.Server{Addr: config.Address, Handler: r}
+    if config.TLSCertFile != "" {
+        tlsCtx, cancelTls := context.WithCancel(context.Background())
+        defer cancelTls()
+        server.TLSConfig, err = createTLSConfig(tlsCtx, config, clientCertMode)
+        if (err != nil) {
+            log.Error("Failed to configure TLS", "error", err)
+            return err
+        }
+    }
+
+    var admin *http.Server
+    if config.AdminAddress != "" {
+        admin = startAdminServer(config.AdminAddress, config.AdminToken, config.MetricsHandler)
+    }
 
     go func() {
         <-quit
         server.Shutdown(context.Background())
+        if admin != nil {
+            admin.Shutdown(context.Background())
+        }
     }()
 
-    log.Info("Launching SubscribeD", "address", config.Address)
-    err = server.ListenAndServe()
+    log.Info("Launching SubscribeD", "address", config.Address, "vendor-ids", vendorIds, "tls", server.TLSConfig != nil)
+    if server.TLSConfig != nil {
+        err = server.ListenAndServeTLS("", "")
+    } else {
+        err = server.ListenAndServe()
+    }
     if (err != nil && err != http.ErrServerClosed ) {
         log.Error("Failed to launch server", "error", err)
         return err
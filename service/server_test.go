@@ -0,0 +1,305 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/auth"
+    "github.com/jupitercloud/subscribed/client"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+    "github.com/jupitercloud/subscribed/store"
+)
+
+const testVendorId = "vendor-1"
+
+// Counts calls reaching the implementation, and can start operations.
+type testService struct {
+    SubscriptionServiceStub
+    subscriptions atomic.Int32
+    // Error returned by CreateResource after starting an operation.
+    createResourceError error
+    // When set, operations wait for it to be closed.
+    operationRelease chan struct{}
+    operationRuns atomic.Int32
+}
+
+func (t *testService) CreateSubscription(request *http.Request, args *api.CreateSubscriptionRequest, reply *api.CreateSubscriptionResponse) error {
+    n := t.subscriptions.Add(1)
+    reply.Url = fmt.Sprintf("https://example.com/subscriptions/%s/%d", args.SubscriptionId, n)
+    return nil
+}
+
+func (t *testService) CreateResource(request *http.Request, args *api.CreateResourceRequest, reply *api.CreateResourceResponse) error {
+    _, err := StartOperation(request, func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+        if t.operationRelease != nil {
+            <-t.operationRelease
+        }
+        t.operationRuns.Add(1)
+        return &api.CreateResourceResponse{Url: "https://example.com/resources/" + args.ResourceId}, nil
+    })
+    if err != nil {
+        return err
+    }
+    return t.createResourceError
+}
+
+func freeAddress(t *testing.T) string {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+    return listener.Addr().String()
+}
+
+// Run a server for impl, verifying tokens from a mock issuer, until the test ends.
+func startTestServer(t *testing.T, config ServerConfig, impl api.SubscriptionServiceInterface) (*issuer.Issuer, string) {
+    i, url := runTestServer(t, config, "http", http.DefaultClient, func(config ServerConfig, quit chan os.Signal) error {
+        return RunServer(config, impl, quit)
+    })
+    return i, url + "/rpc"
+}
+
+// Run a server with run, waiting until httpClient sees it ready. Returns the
+// issuer and the server's base URL.
+func runTestServer(t *testing.T, config ServerConfig, scheme string, httpClient *http.Client, run func(config ServerConfig, quit chan os.Signal) error) (*issuer.Issuer, string) {
+    i, issuerServer, err := issuer.StartTestIssuer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(issuerServer.Close)
+
+    config.Issuer = i.URL()
+    config.VendorId = testVendorId
+    config.Address = freeAddress(t)
+    quit := make(chan os.Signal, 1)
+    done := make(chan error, 1)
+    go func() {
+        done <- run(config, quit)
+    }()
+    t.Cleanup(func() {
+        quit <- os.Interrupt
+        <-done
+    })
+
+    url := scheme + "://" + config.Address
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        response, err := httpClient.Get(url + "/readyz")
+        if err == nil {
+            response.Body.Close()
+            if response.StatusCode == http.StatusOK {
+                break
+            }
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("server not ready")
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+    return i, url
+}
+
+// Create a client authenticated with a freshly minted token.
+func newTestClient(t *testing.T, i *issuer.Issuer, url string, claims issuer.TokenClaims) *client.Client {
+    claims.VendorId = testVendorId
+    token, err := i.Mint(claims)
+    if err != nil {
+        t.Fatal(err)
+    }
+    c := client.NewClient(url)
+    c.SetToken(token)
+    return c
+}
+
+func expectCode(t *testing.T, err error, code json2.ErrorCode) {
+    t.Helper()
+    rpcErr, ok := err.(*json2.Error)
+    if !ok || rpcErr.Code != code {
+        t.Fatalf("expected error code %d, got %v", code, err)
+    }
+}
+
+func TestAccountScope(t *testing.T) {
+    i, url := startTestServer(t, ServerConfig{}, &testService{})
+    ctx := context.Background()
+
+    scoped := newTestClient(t, i, url, issuer.TokenClaims{AccountId: "acct-1"})
+    _, err := scoped.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-2", SubscriptionId: "sub-1", Sku: 1})
+    expectCode(t, err, errors.CodeAccountScope)
+    if _, err := scoped.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+
+    // Vendor-wide tokens may act on any account.
+    vendorWide := newTestClient(t, i, url, issuer.TokenClaims{})
+    if _, err := vendorWide.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-2", SubscriptionId: "sub-2", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestCreateSubscriptionReplay(t *testing.T) {
+    configs := map[string]ServerConfig{
+        "memory": {Store: store.NewMemoryStore()},
+        // Without a store, the server falls back to an in-memory one.
+        "default": {},
+    }
+    for name, config := range configs {
+        t.Run(name, func(t *testing.T) {
+            impl := &testService{}
+            i, url := startTestServer(t, config, impl)
+            c := newTestClient(t, i, url, issuer.TokenClaims{})
+            ctx := context.Background()
+            args := &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}
+
+            first, err := c.CreateSubscription(ctx, args)
+            if err != nil {
+                t.Fatal(err)
+            }
+            // Account data may change between a call and its retry.
+            args.AccountData = api.Metadata{"plan": "gold"}
+            retried, err := c.CreateSubscription(ctx, args)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if retried.Url != first.Url {
+                t.Errorf("replay returned %q, expected the original %q", retried.Url, first.Url)
+            }
+            if calls := impl.subscriptions.Load(); calls != 1 {
+                t.Errorf("implementation called %d times, expected once", calls)
+            }
+
+            _, err = c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 2})
+            expectCode(t, err, errors.CodeConflict)
+            _, err = c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-2", SubscriptionId: "sub-1", Sku: 1})
+            expectCode(t, err, errors.CodeConflict)
+        })
+    }
+}
+
+func TestOperationDiscardedOnError(t *testing.T) {
+    impl := &testService{createResourceError: fmt.Errorf("provisioning rejected")}
+    i, url := startTestServer(t, ServerConfig{}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+
+    _, err := c.CreateResource(context.Background(), &api.CreateResourceRequest{AccountId: "acct-1", SubscriptionId: "sub-1", ResourceId: "res-1", Sku: 1})
+    if err == nil {
+        t.Fatal("expected the implementation's error")
+    }
+    time.Sleep(100 * time.Millisecond)
+    if runs := impl.operationRuns.Load(); runs != 0 {
+        t.Fatalf("operation ran %d times for a failed call", runs)
+    }
+}
+
+func TestOperationRecorded(t *testing.T) {
+    impl := &testService{}
+    entitlements := store.NewMemoryStore()
+    i, url := startTestServer(t, ServerConfig{Store: entitlements}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+
+    reply, err := c.CreateResource(ctx, &api.CreateResourceRequest{AccountId: "acct-1", SubscriptionId: "sub-1", ResourceId: "res-1", Sku: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if reply.Operation == nil {
+        t.Fatal("expected a pending operation")
+    }
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        resource, err := entitlements.GetResource(ctx, "res-1")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if resource.Status == store.StatusActive {
+            if resource.Url != "https://example.com/resources/res-1" {
+                t.Errorf("recorded URL %q", resource.Url)
+            }
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("resource status %s, expected %s", resource.Status, store.StatusActive)
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+func TestTerminatedResourceIgnoresOperation(t *testing.T) {
+    impl := &testService{operationRelease: make(chan struct{})}
+    entitlements := store.NewMemoryStore()
+    i, url := startTestServer(t, ServerConfig{Store: entitlements}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+
+    created, err := c.CreateResource(ctx, &api.CreateResourceRequest{AccountId: "acct-1", SubscriptionId: "sub-1", ResourceId: "res-1", Sku: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Terminate synchronously while provisioning is still running.
+    if _, err := c.TerminateResource(ctx, &api.TerminateResourceRequest{AccountId: "acct-1", SubscriptionId: "sub-1", ResourceId: "res-1", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+    resource, err := entitlements.GetResource(ctx, "res-1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resource.Status != store.StatusTerminated || resource.OperationId != "" {
+        t.Fatalf("after terminate: status %s, operation %q", resource.Status, resource.OperationId)
+    }
+
+    close(impl.operationRelease)
+    status := &api.GetOperationStatusRequest{AccountId: "acct-1", OperationId: created.Operation.OperationId}
+    for deadline := time.Now().Add(5 * time.Second); ; {
+        reply, err := c.GetOperationStatus(ctx, status)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if reply.Operation.State == api.OperationStateSucceeded {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("operation did not finish")
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+    time.Sleep(100 * time.Millisecond)
+    resource, err = entitlements.GetResource(ctx, "res-1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resource.Status != store.StatusTerminated {
+        t.Fatalf("operation outcome changed terminated resource to %s", resource.Status)
+    }
+}
+
+func TestReplayProtectedRetry(t *testing.T) {
+    impl := &testService{}
+    i, url := startTestServer(t, ServerConfig{ReplayCache: auth.NewMemoryReplayCache(100)}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+    args := &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}
+
+    // The platform retries with the same token; the recorded reply is replayed.
+    first, err := c.CreateSubscription(ctx, args)
+    if err != nil {
+        t.Fatal(err)
+    }
+    retried, err := c.CreateSubscription(ctx, args)
+    if err != nil {
+        t.Fatalf("retry rejected: %v", err)
+    }
+    if retried.Url != first.Url || impl.subscriptions.Load() != 1 {
+        t.Fatalf("retry not replayed: %q, %d calls", retried.Url, impl.subscriptions.Load())
+    }
+
+    _, err = c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-2", Sku: 1})
+    expectCode(t, err, errors.CodeTokenReplayed)
+}
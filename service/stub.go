@@ -34,6 +34,18 @@ func (t *SubscriptionServiceStub) CreateSubscription(request *http.Request, args
     return nil
 }
 
+func (t *SubscriptionServiceStub) UpdateSubscription(request *http.Request, args *api.UpdateSubscriptionRequest, reply *api.UpdateSubscriptionResponse) error {
+    return nil
+}
+
+func (t *SubscriptionServiceStub) SuspendSubscription(request *http.Request, args *api.SuspendSubscriptionRequest, reply *api.SuspendSubscriptionResponse) error {
+    return nil
+}
+
+func (t *SubscriptionServiceStub) ResumeSubscription(request *http.Request, args *api.ResumeSubscriptionRequest, reply *api.ResumeSubscriptionResponse) error {
+    return nil
+}
+
 func (t *SubscriptionServiceStub) TerminateSubscription(request *http.Request, args *api.TerminateSubscriptionRequest, reply *api.TerminateSubscriptionResponse) error {
     return nil
 }
@@ -42,6 +54,10 @@ func (t *SubscriptionServiceStub) CreateResource(request *http.Request, args *ap
     return nil
 }
 
+func (t *SubscriptionServiceStub) UpdateResource(request *http.Request, args *api.UpdateResourceRequest, reply *api.UpdateResourceResponse) error {
+    return nil
+}
+
 func (t *SubscriptionServiceStub) TerminateResource(request *http.Request, args *api.TerminateResourceRequest, reply *api.TerminateResourceResponse) error {
     return nil
 }
@@ -1,24 +1,47 @@
 package service
 
 import (
+    "context"
     "net/http"
+    "time"
 
     "go.opentelemetry.io/otel/attribute"
     "go.opentelemetry.io/otel/trace"
     "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/audit"
     "github.com/jupitercloud/subscribed/auth"
+    "github.com/jupitercloud/subscribed/catalog"
     "github.com/jupitercloud/subscribed/errors"
     "github.com/jupitercloud/subscribed/logger"
+    "github.com/jupitercloud/subscribed/redact"
+    "github.com/jupitercloud/subscribed/schema"
+    "github.com/jupitercloud/subscribed/store"
 )
 
-var log = logger.Named("SubscriptionService");
+var log = logger.Named("service");
 
 // This SubscriptionService wrapper wraps an implementation with token verification and logging.
 type SubscriptionService struct{
     impl api.SubscriptionServiceInterface
+    // Optional entitlement store, written after each successful call.
+    store store.Store
+    // Serializes create/terminate calls by subscription or resource ID.
+    locker idLocker
+    // Runs asynchronous operations started by the implementation.
+    operations *operationWorker
+    // Optional per-SKU resource configuration schemas.
+    schemas *schema.Registry
+    // Optional catalog of supported SKUs.
+    catalog *catalog.Catalog
+    // Optional scopes required by each method.
+    scopes ScopePolicy
+    // Optional tamper-evident log of every RPC.
+    auditLog *audit.Log
 }
 
-func verifyAuthorization (request *http.Request) (*auth.Claims, error) {
+// Verify the request is authorized, and that the token carries the scopes the
+// policy requires for method.
+func (self *SubscriptionService) verifyAuthorization (request *http.Request, method string) (*auth.Claims, error) {
     var claims *auth.Claims = request.Context().Value("claims").(*auth.Claims)
     if claims == nil {
         return nil, errors.Unauthenticated()
@@ -26,11 +49,46 @@ func verifyAuthorization (request *http.Request) (*auth.Claims, error) {
     if claims.Error != nil {
         return nil, claims.Error
     }
+    if err := self.scopes.authorize(method, claims); err != nil {
+        return nil, err
+    }
     return claims, nil
 }
 
-func (self *SubscriptionService) HealthCheck(request *http.Request, args *api.HealthCheckRequest, reply *api.HealthCheckResponse) error {
-    _, err := verifyAuthorization(request)
+// Verify the request is authorized, and that the token's account scope covers accountId.
+// Vendor-wide tokens carry no accountId claim and may operate on any account.
+func (self *SubscriptionService) verifyAccountAuthorization (request *http.Request, method string, accountId string) (*auth.Claims, error) {
+    claims, err := self.verifyAuthorization(request, method)
+    if err != nil {
+        return nil, err
+    }
+    if claims.AccountId != "" && claims.AccountId != accountId {
+        log.Warn("Account outside of token scope", "scope", claims.AccountId, "account-id", accountId)
+        return nil, errors.AccountScopeError(accountId)
+    }
+    return claims, nil
+}
+
+// Finish an RPC: mask sensitive error details, trace and log the redacted
+// arguments, record metrics, and audit the call. Deferred by each method with a pointer to its
+// named error result.
+func (self *SubscriptionService) complete(request *http.Request, method string, args interface{}, start time.Time, err *error) {
+    *err = redact.Error(*err)
+    span := trace.SpanFromContext(request.Context())
+    if span.IsRecording() {
+        span.SetAttributes(attribute.String("rpc.request", redact.JSON(args)))
+    }
+    if log.IsDebug() {
+        log.Debug("RPC arguments", "method", method, "args", args)
+    }
+    self.measure(request, method, args, start, *err)
+    self.audit(request, method, args, start, *err)
+}
+
+func (self *SubscriptionService) HealthCheck(request *http.Request, args *api.HealthCheckRequest, reply *api.HealthCheckResponse) (err error) {
+    defer self.complete(request, "HealthCheck", args, self.begin("HealthCheck"), &err)
+
+    _, err = self.verifyAuthorization(request, "HealthCheck")
     if err != nil {
         return err
     }
@@ -39,8 +97,10 @@ func (self *SubscriptionService) HealthCheck(request *http.Request, args *api.He
     return self.impl.HealthCheck(request, args, reply)
 }
 
-func (self *SubscriptionService) OpenAccount(request *http.Request, args *api.OpenAccountRequest, reply *api.OpenAccountResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) OpenAccount(request *http.Request, args *api.OpenAccountRequest, reply *api.OpenAccountResponse) (err error) {
+    defer self.complete(request, "OpenAccount", args, self.begin("OpenAccount"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "OpenAccount", args.AccountId)
     if err != nil {
         return err
     }
@@ -52,11 +112,17 @@ func (self *SubscriptionService) OpenAccount(request *http.Request, args *api.Op
         attribute.String("account.account_id", args.AccountId),
     )
 
-    return self.impl.OpenAccount(request, args, reply)
+    err = self.impl.OpenAccount(request, args, reply)
+    if err == nil {
+        self.recordOpenAccount(request.Context(), args, reply)
+    }
+    return err
 }
 
-func (self *SubscriptionService) CloseAccount(request *http.Request, args *api.CloseAccountRequest, reply *api.CloseAccountResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) CloseAccount(request *http.Request, args *api.CloseAccountRequest, reply *api.CloseAccountResponse) (err error) {
+    defer self.complete(request, "CloseAccount", args, self.begin("CloseAccount"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "CloseAccount", args.AccountId)
     if err != nil {
         return err
     }
@@ -68,11 +134,17 @@ func (self *SubscriptionService) CloseAccount(request *http.Request, args *api.C
         attribute.String("account.account_id", args.AccountId),
     )
 
-    return self.impl.CloseAccount(request, args, reply)
+    err = self.impl.CloseAccount(request, args, reply)
+    if err == nil {
+        self.recordCloseAccount(request.Context(), args)
+    }
+    return err
 }
 
-func (self *SubscriptionService) CreateSubscription(request *http.Request, args *api.CreateSubscriptionRequest, reply *api.CreateSubscriptionResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) CreateSubscription(request *http.Request, args *api.CreateSubscriptionRequest, reply *api.CreateSubscriptionResponse) (err error) {
+    defer self.complete(request, "CreateSubscription", args, self.begin("CreateSubscription"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "CreateSubscription", args.AccountId)
     if err != nil {
         return err
     }
@@ -86,11 +158,136 @@ func (self *SubscriptionService) CreateSubscription(request *http.Request, args
         attribute.Int64("subscription.sku", args.Sku),
     )
 
-    return self.impl.CreateSubscription(request, args, reply)
+    if self.catalog != nil {
+        if unsupported := self.catalog.Verify(args.Sku); unsupported != nil {
+            return unsupported
+        }
+    }
+
+    unlock := self.locker.lock(args.SubscriptionId)
+    defer unlock()
+
+    replayed, err := self.replayCreateSubscription(request.Context(), args, reply)
+    if err != nil || replayed {
+        return err
+    }
+
+    err = self.impl.CreateSubscription(request, args, reply)
+    if err == nil {
+        self.recordCreateSubscription(request.Context(), args, reply)
+    }
+    return err
+}
+
+func (self *SubscriptionService) UpdateSubscription(request *http.Request, args *api.UpdateSubscriptionRequest, reply *api.UpdateSubscriptionResponse) (err error) {
+    defer self.complete(request, "UpdateSubscription", args, self.begin("UpdateSubscription"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "UpdateSubscription", args.AccountId)
+    if err != nil {
+        return err
+    }
+
+    log.Debug("RPC UpdateSubscription")
+
+    span := trace.SpanFromContext(request.Context())
+    span.SetAttributes(
+        attribute.String("subscription.account_id", args.AccountId),
+        attribute.String("subscription.subscription_id", args.SubscriptionId),
+        attribute.Int64("subscription.old_sku", args.OldSku),
+        attribute.Int64("subscription.new_sku", args.NewSku),
+    )
+
+    if self.catalog != nil {
+        if unsupported := self.catalog.Verify(args.NewSku); unsupported != nil {
+            return unsupported
+        }
+    }
+
+    unlock := self.locker.lock(args.SubscriptionId)
+    defer unlock()
+
+    replayed, err := self.replayUpdateSubscription(request.Context(), args, reply)
+    if err != nil || replayed {
+        return err
+    }
+
+    err = self.impl.UpdateSubscription(request, args, reply)
+    if err == nil {
+        self.recordUpdateSubscription(request.Context(), args, reply)
+    }
+    return err
+}
+
+func (self *SubscriptionService) SuspendSubscription(request *http.Request, args *api.SuspendSubscriptionRequest, reply *api.SuspendSubscriptionResponse) (err error) {
+    defer self.complete(request, "SuspendSubscription", args, self.begin("SuspendSubscription"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "SuspendSubscription", args.AccountId)
+    if err != nil {
+        return err
+    }
+
+    log.Debug("RPC SuspendSubscription")
+
+    span := trace.SpanFromContext(request.Context())
+    span.SetAttributes(
+        attribute.String("subscription.account_id", args.AccountId),
+        attribute.String("subscription.subscription_id", args.SubscriptionId),
+        attribute.Int64("subscription.sku", args.Sku),
+        attribute.String("subscription.reason", args.Reason),
+    )
+
+    unlock := self.locker.lock(args.SubscriptionId)
+    defer unlock()
+
+    replayed, err := self.replaySuspendSubscription(request.Context(), args)
+    if err != nil || replayed {
+        return err
+    }
+
+    err = self.impl.SuspendSubscription(request, args, reply)
+    if err == nil {
+        self.recordSuspendSubscription(request.Context(), args)
+    }
+    return err
+}
+
+func (self *SubscriptionService) ResumeSubscription(request *http.Request, args *api.ResumeSubscriptionRequest, reply *api.ResumeSubscriptionResponse) (err error) {
+    defer self.complete(request, "ResumeSubscription", args, self.begin("ResumeSubscription"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "ResumeSubscription", args.AccountId)
+    if err != nil {
+        return err
+    }
+
+    log.Debug("RPC ResumeSubscription")
+
+    span := trace.SpanFromContext(request.Context())
+    span.SetAttributes(
+        attribute.String("subscription.account_id", args.AccountId),
+        attribute.String("subscription.subscription_id", args.SubscriptionId),
+        attribute.Int64("subscription.sku", args.Sku),
+        attribute.String("subscription.reason", args.Reason),
+    )
+
+    unlock := self.locker.lock(args.SubscriptionId)
+    defer unlock()
+
+    replayed, err := self.replayResumeSubscription(request.Context(), args)
+    if err != nil || replayed {
+        return err
+    }
+
+    err = self.impl.ResumeSubscription(request, args, reply)
+    if err == nil {
+        self.recordResumeSubscription(request.Context(), args)
+    }
+    return err
 }
 
-func (self *SubscriptionService) TerminateSubscription(request *http.Request, args *api.TerminateSubscriptionRequest, reply *api.TerminateSubscriptionResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) TerminateSubscription(request *http.Request, args *api.TerminateSubscriptionRequest, reply *api.TerminateSubscriptionResponse) (err error) {
+    defer self.complete(request, "TerminateSubscription", args, self.begin("TerminateSubscription"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "TerminateSubscription", args.AccountId)
     if err != nil {
         return err
     }
@@ -104,11 +301,25 @@ func (self *SubscriptionService) TerminateSubscription(request *http.Request, ar
         attribute.Int64("subscription.sku", args.Sku),
     )
 
-    return self.impl.TerminateSubscription(request, args, reply)
+    unlock := self.locker.lock(args.SubscriptionId)
+    defer unlock()
+
+    replayed, err := self.replayTerminateSubscription(request.Context(), args)
+    if err != nil || replayed {
+        return err
+    }
+
+    err = self.impl.TerminateSubscription(request, args, reply)
+    if err == nil {
+        self.recordTerminateSubscription(request.Context(), args)
+    }
+    return err
 }
 
-func (self *SubscriptionService) CreateResource(request *http.Request, args *api.CreateResourceRequest, reply *api.CreateResourceResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) CreateResource(request *http.Request, args *api.CreateResourceRequest, reply *api.CreateResourceResponse) (err error) {
+    defer self.complete(request, "CreateResource", args, self.begin("CreateResource"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "CreateResource", args.AccountId)
     if err != nil {
         return err
     }
@@ -123,11 +334,96 @@ func (self *SubscriptionService) CreateResource(request *http.Request, args *api
         attribute.Int64("resource.sku", args.Sku),
     )
 
-    return self.impl.CreateResource(request, args, reply)
+    if self.catalog != nil {
+        if invalid := self.catalog.Validate(args.Sku, args.Configuration); invalid != nil {
+            return invalid
+        }
+    }
+    if self.schemas != nil {
+        if invalid := self.schemas.Validate(args.Sku, args.Configuration); invalid != nil {
+            return invalid
+        }
+    }
+
+    unlock := self.locker.lock(args.ResourceId)
+    defer unlock()
+
+    replayed, err := self.replayCreateResource(request.Context(), args, reply)
+    if err != nil || replayed {
+        return err
+    }
+
+    scope := &operationScope{
+        worker: self.operations,
+        method: "CreateResource",
+        accountId: args.AccountId,
+        subscriptionId: args.SubscriptionId,
+        resourceId: args.ResourceId,
+    }
+    err = scope.reserve()
+    if err != nil {
+        return err
+    }
+    defer scope.discard()
+    request = request.WithContext(context.WithValue(request.Context(), "operationScope", scope))
+
+    err = self.impl.CreateResource(request, args, reply)
+    if err == nil {
+        scope.dispatch()
+        reply.Operation = scope.operation
+        self.recordCreateResource(request.Context(), args, reply)
+    }
+    return err
 }
 
-func (self *SubscriptionService) TerminateResource(request *http.Request, args *api.TerminateResourceRequest, reply *api.TerminateResourceResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) UpdateResource(request *http.Request, args *api.UpdateResourceRequest, reply *api.UpdateResourceResponse) (err error) {
+    defer self.complete(request, "UpdateResource", args, self.begin("UpdateResource"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "UpdateResource", args.AccountId)
+    if err != nil {
+        return err
+    }
+
+    log.Debug("RPC UpdateResource")
+
+    span := trace.SpanFromContext(request.Context())
+    span.SetAttributes(
+        attribute.String("resource.account_id", args.AccountId),
+        attribute.String("resource.subscription_id", args.SubscriptionId),
+        attribute.String("resource.resource_id", args.ResourceId),
+        attribute.Int64("resource.sku", args.Sku),
+    )
+
+    if self.catalog != nil {
+        if invalid := self.catalog.Validate(args.Sku, args.Configuration); invalid != nil {
+            return invalid
+        }
+    }
+    if self.schemas != nil {
+        if invalid := self.schemas.Validate(args.Sku, args.Configuration); invalid != nil {
+            return invalid
+        }
+    }
+
+    unlock := self.locker.lock(args.ResourceId)
+    defer unlock()
+
+    replayed, err := self.replayUpdateResource(request.Context(), args, reply)
+    if err != nil || replayed {
+        return err
+    }
+
+    err = self.impl.UpdateResource(request, args, reply)
+    if err == nil {
+        self.recordUpdateResource(request.Context(), args, reply)
+    }
+    return err
+}
+
+func (self *SubscriptionService) TerminateResource(request *http.Request, args *api.TerminateResourceRequest, reply *api.TerminateResourceResponse) (err error) {
+    defer self.complete(request, "TerminateResource", args, self.begin("TerminateResource"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "TerminateResource", args.AccountId)
     if err != nil {
         return err
     }
@@ -142,11 +438,41 @@ func (self *SubscriptionService) TerminateResource(request *http.Request, args *
         attribute.Int64("resource.sku", args.Sku),
     )
 
-    return self.impl.TerminateResource(request, args, reply)
+    unlock := self.locker.lock(args.ResourceId)
+    defer unlock()
+
+    replayed, err := self.replayTerminateResource(request.Context(), args, reply)
+    if err != nil || replayed {
+        return err
+    }
+
+    scope := &operationScope{
+        worker: self.operations,
+        method: "TerminateResource",
+        accountId: args.AccountId,
+        subscriptionId: args.SubscriptionId,
+        resourceId: args.ResourceId,
+    }
+    err = scope.reserve()
+    if err != nil {
+        return err
+    }
+    defer scope.discard()
+    request = request.WithContext(context.WithValue(request.Context(), "operationScope", scope))
+
+    err = self.impl.TerminateResource(request, args, reply)
+    if err == nil {
+        scope.dispatch()
+        reply.Operation = scope.operation
+        self.recordTerminateResource(request.Context(), args, reply)
+    }
+    return err
 }
 
-func (self *SubscriptionService) GetSubscriptionUsage(request *http.Request, args *api.GetSubscriptionUsageRequest, reply *api.GetSubscriptionUsageResponse) error {
-    _, err := verifyAuthorization(request)
+func (self *SubscriptionService) GetSubscriptionUsage(request *http.Request, args *api.GetSubscriptionUsageRequest, reply *api.GetSubscriptionUsageResponse) (err error) {
+    defer self.complete(request, "GetSubscriptionUsage", args, self.begin("GetSubscriptionUsage"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "GetSubscriptionUsage", args.AccountId)
     if err != nil {
         return err
     }
@@ -162,8 +488,57 @@ func (self *SubscriptionService) GetSubscriptionUsage(request *http.Request, arg
     return self.impl.GetSubscriptionUsage(request, args, reply)
 }
 
-func createSubscriptionService(impl api.SubscriptionServiceInterface) *SubscriptionService {
-    return &SubscriptionService{
+func (self *SubscriptionService) GetCatalog(request *http.Request, args *api.GetCatalogRequest, reply *api.GetCatalogResponse) (err error) {
+    defer self.complete(request, "GetCatalog", args, self.begin("GetCatalog"), &err)
+
+    _, err = self.verifyAuthorization(request, "GetCatalog")
+    if err != nil {
+        return err
+    }
+
+    log.Debug("RPC GetCatalog")
+
+    reply.Skus = []api.CatalogSku{}
+    if self.catalog != nil {
+        reply.Skus = self.catalog.Skus()
+    }
+    return nil
+}
+
+func (self *SubscriptionService) GetOperationStatus(request *http.Request, args *api.GetOperationStatusRequest, reply *api.GetOperationStatusResponse) (err error) {
+    defer self.complete(request, "GetOperationStatus", args, self.begin("GetOperationStatus"), &err)
+
+    _, err = self.verifyAccountAuthorization(request, "GetOperationStatus", args.AccountId)
+    if err != nil {
+        return err
+    }
+
+    log.Debug("RPC GetOperationStatus")
+
+    span := trace.SpanFromContext(request.Context())
+    span.SetAttributes(
+        attribute.String("operation.account_id", args.AccountId),
+        attribute.String("operation.operation_id", args.OperationId),
+    )
+
+    status, accountId, ok := self.operations.get(args.OperationId)
+    if !ok || accountId != args.AccountId {
+        return errors.OperationNotFoundError(args.OperationId)
+    }
+    reply.Operation = *status
+    return nil
+}
+
+func createSubscriptionService(impl api.SubscriptionServiceInterface, config ServerConfig, operations *operationWorker) *SubscriptionService {
+    svc := &SubscriptionService{
       impl: impl,
+      store: config.Store,
+      operations: operations,
+      schemas: config.Schemas,
+      catalog: config.Catalog,
+      scopes: config.ScopePolicy,
+      auditLog: config.AuditLog,
     }
+    operations.onComplete = svc.recordOperation
+    return svc
 }
@@ -0,0 +1,206 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "sync/atomic"
+    "testing"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/catalog"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+    "github.com/jupitercloud/subscribed/store"
+)
+
+// Counts subscription changes reaching the implementation.
+type changeService struct {
+    testService
+    updates atomic.Int32
+    suspensions atomic.Int32
+    // Reason passed to the last SuspendSubscription.
+    suspendReason atomic.Value
+}
+
+func (t *changeService) UpdateSubscription(request *http.Request, args *api.UpdateSubscriptionRequest, reply *api.UpdateSubscriptionResponse) error {
+    t.updates.Add(1)
+    reply.Url = "https://example.com/upgraded"
+    return nil
+}
+
+func (t *changeService) SuspendSubscription(request *http.Request, args *api.SuspendSubscriptionRequest, reply *api.SuspendSubscriptionResponse) error {
+    t.suspensions.Add(1)
+    t.suspendReason.Store(args.Reason)
+    return nil
+}
+
+func TestUpdateSubscription(t *testing.T) {
+    impl := &changeService{}
+    entitlements := store.NewMemoryStore()
+    i, url := startTestServer(t, ServerConfig{Store: entitlements}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+
+    if _, err := c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+    args := &api.UpdateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", OldSku: 1, NewSku: 2}
+    if _, err := c.UpdateSubscription(ctx, args); err != nil {
+        t.Fatal(err)
+    }
+    subscription, err := entitlements.GetSubscription(ctx, "sub-1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if subscription.Sku != 2 {
+        t.Fatalf("recorded SKU %d, expected 2", subscription.Sku)
+    }
+
+    // A retry replays the recorded reply.
+    retried, err := c.UpdateSubscription(ctx, args)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if retried.Url != "https://example.com/upgraded" {
+        t.Errorf("replay returned %q", retried.Url)
+    }
+    if updates := impl.updates.Load(); updates != 1 {
+        t.Errorf("implementation called %d times, expected once", updates)
+    }
+
+    // A change from a SKU the subscription no longer has conflicts.
+    _, err = c.UpdateSubscription(ctx, &api.UpdateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", OldSku: 3, NewSku: 4})
+    expectCode(t, err, errors.CodeConflict)
+}
+
+func TestSuspendAndResume(t *testing.T) {
+    impl := &changeService{}
+    entitlements := store.NewMemoryStore()
+    i, url := startTestServer(t, ServerConfig{Store: entitlements}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+
+    if _, err := c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+    // Reason codes unknown to this server are passed through.
+    suspend := &api.SuspendSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1, Reason: "CHARGEBACK"}
+    for attempt := 0; attempt < 2; attempt++ {
+        if _, err := c.SuspendSubscription(ctx, suspend); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if suspensions := impl.suspensions.Load(); suspensions != 1 {
+        t.Errorf("implementation called %d times, expected once", suspensions)
+    }
+    if reason := impl.suspendReason.Load(); reason != "CHARGEBACK" {
+        t.Errorf("implementation given reason %v", reason)
+    }
+    subscription, err := entitlements.GetSubscription(ctx, "sub-1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if subscription.Status != store.StatusSuspended || subscription.SuspendReason != "CHARGEBACK" {
+        t.Fatalf("recorded %s for %q", subscription.Status, subscription.SuspendReason)
+    }
+
+    if _, err := c.ResumeSubscription(ctx, &api.ResumeSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1, Reason: "CHARGEBACK"}); err != nil {
+        t.Fatal(err)
+    }
+    subscription, err = entitlements.GetSubscription(ctx, "sub-1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if subscription.Status != store.StatusActive || subscription.SuspendReason != "" {
+        t.Fatalf("recorded %s for %q after resume", subscription.Status, subscription.SuspendReason)
+    }
+
+    // Terminated subscriptions cannot be suspended.
+    if _, err := c.TerminateSubscription(ctx, &api.TerminateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}); err != nil {
+        t.Fatal(err)
+    }
+    _, err = c.SuspendSubscription(ctx, suspend)
+    expectCode(t, err, errors.CodeConflict)
+}
+
+// Provisions resources synchronously, counting updates.
+type resourceService struct {
+    SubscriptionServiceStub
+    updates atomic.Int32
+}
+
+func (t *resourceService) UpdateResource(request *http.Request, args *api.UpdateResourceRequest, reply *api.UpdateResourceResponse) error {
+    t.updates.Add(1)
+    return nil
+}
+
+func TestUpdateResource(t *testing.T) {
+    impl := &resourceService{}
+    entitlements := store.NewMemoryStore()
+    i, url := startTestServer(t, ServerConfig{Store: entitlements}, impl)
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+
+    small := json.RawMessage(`{"size":"small"}`)
+    large := json.RawMessage(`{"size": "large"}`)
+    if _, err := c.CreateResource(ctx, &api.CreateResourceRequest{AccountId: "acct-1", SubscriptionId: "sub-1", ResourceId: "res-1", Sku: 1, Configuration: small}); err != nil {
+        t.Fatal(err)
+    }
+    args := &api.UpdateResourceRequest{
+        AccountId: "acct-1",
+        SubscriptionId: "sub-1",
+        ResourceId: "res-1",
+        Sku: 1,
+        PreviousConfiguration: small,
+        Configuration: large,
+    }
+    for attempt := 0; attempt < 2; attempt++ {
+        if _, err := c.UpdateResource(ctx, args); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if updates := impl.updates.Load(); updates != 1 {
+        t.Errorf("implementation called %d times, expected once", updates)
+    }
+    resource, err := entitlements.GetResource(ctx, "res-1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !sameJson(resource.Configuration, large) {
+        t.Fatalf("recorded configuration %s", resource.Configuration)
+    }
+
+    // An update from a stale configuration conflicts.
+    _, err = c.UpdateResource(ctx, &api.UpdateResourceRequest{
+        AccountId: "acct-1",
+        SubscriptionId: "sub-1",
+        ResourceId: "res-1",
+        Sku: 1,
+        PreviousConfiguration: small,
+        Configuration: json.RawMessage(`{"size":"medium"}`),
+    })
+    expectCode(t, err, errors.CodeConflict)
+}
+
+func TestGetCatalog(t *testing.T) {
+    skus := catalog.NewCatalog()
+    for _, sku := range []api.CatalogSku{{Sku: 2, Name: "Large"}, {Sku: 1, Name: "Small"}} {
+        if err := skus.Register(sku); err != nil {
+            t.Fatal(err)
+        }
+    }
+    i, url := startTestServer(t, ServerConfig{Catalog: skus}, &resourceService{})
+    c := newTestClient(t, i, url, issuer.TokenClaims{})
+    ctx := context.Background()
+
+    reply, err := c.GetCatalog(ctx, &api.GetCatalogRequest{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(reply.Skus) != 2 || reply.Skus[0].Name != "Small" {
+        t.Fatalf("unexpected catalog: %+v", reply.Skus)
+    }
+    _, err = c.CreateSubscription(ctx, &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 3})
+    expectCode(t, err, errors.CodeUnsupportedSku)
+}
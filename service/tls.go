@@ -0,0 +1,137 @@
+package service
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/jupitercloud/subscribed/auth"
+)
+
+// Serves a TLS certificate and key from disk, reloading them when either file
+// changes so certificates can be renewed without a restart.
+type certReloader struct {
+    certFile string
+    keyFile string
+    mutex sync.RWMutex
+    cert *tls.Certificate
+    modTime time.Time
+}
+
+// Latest modification time of the certificate and key files.
+func (r *certReloader) lastModified() (time.Time, error) {
+    certInfo, err := os.Stat(r.certFile)
+    if err != nil {
+        return time.Time{}, err
+    }
+    keyInfo, err := os.Stat(r.keyFile)
+    if err != nil {
+        return time.Time{}, err
+    }
+    if keyInfo.ModTime().After(certInfo.ModTime()) {
+        return keyInfo.ModTime(), nil
+    }
+    return certInfo.ModTime(), nil
+}
+
+// Load the certificate and key if either changed since the last load.
+func (r *certReloader) reload() error {
+    modTime, err := r.lastModified()
+    if err != nil {
+        return err
+    }
+    r.mutex.RLock()
+    unchanged := modTime.Equal(r.modTime)
+    r.mutex.RUnlock()
+    if unchanged {
+        return nil
+    }
+
+    cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+    if err != nil {
+        return err
+    }
+    r.mutex.Lock()
+    r.cert = &cert
+    r.modTime = modTime
+    r.mutex.Unlock()
+    log.Info("Loaded TLS certificate", "cert-file", r.certFile)
+    return nil
+}
+
+// Reload the files every interval until ctx is done. Failures, e.g. while a
+// renewal is half written, keep the previous certificate.
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            if err := r.reload(); err != nil {
+                log.Error("Failed to reload TLS certificate", "cert-file", r.certFile, "error", err)
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Implements tls.Config.GetCertificate.
+func (r *certReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+    return r.cert, nil
+}
+
+func newCertReloader(certFile string, keyFile string) *certReloader {
+    return &certReloader{certFile: certFile, keyFile: keyFile}
+}
+
+// Load a pool of PEM encoded CA certificates.
+func loadCertPool(path string) (*x509.CertPool, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    pool := x509.NewCertPool()
+    if !pool.AppendCertsFromPEM(data) {
+        return nil, fmt.Errorf("%s: no certificates found", path)
+    }
+    return pool, nil
+}
+
+// Build the server TLS configuration, starting a watcher which reloads the
+// certificate until ctx is done.
+func createTLSConfig(ctx context.Context, config ServerConfig, clientCertMode string) (*tls.Config, error) {
+    reloader := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+    if err := reloader.reload(); err != nil {
+        return nil, err
+    }
+    interval := config.TLSReloadInterval
+    if interval <= 0 {
+        interval = time.Minute
+    }
+    go reloader.watch(ctx, interval)
+
+    tlsConfig := &tls.Config{
+        MinVersion: tls.VersionTLS12,
+        GetCertificate: reloader.getCertificate,
+    }
+    if config.ClientCAFile != "" {
+        pool, err := loadCertPool(config.ClientCAFile)
+        if err != nil {
+            return nil, err
+        }
+        tlsConfig.ClientCAs = pool
+        // Callers authenticating with a token alone may connect without a certificate.
+        tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+        if clientCertMode == auth.ClientCertOrToken {
+            tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+        }
+    }
+    return tlsConfig, nil
+}
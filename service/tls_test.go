@@ -0,0 +1,238 @@
+package service
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net"
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/auth"
+    "github.com/jupitercloud/subscribed/client"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+// A throwaway CA issuing server and client certificates into a temporary directory.
+type testPKI struct {
+    dir string
+    cert *x509.Certificate
+    key *ecdsa.PrivateKey
+    caFile string
+    serial int64
+}
+
+func writePem(t *testing.T, path string, blockType string, der []byte) {
+    t.Helper()
+    if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject: pkix.Name{CommonName: "test-ca"},
+        NotBefore: time.Now().Add(-time.Hour),
+        NotAfter: time.Now().Add(time.Hour),
+        IsCA: true,
+        BasicConstraintsValid: true,
+        KeyUsage: x509.KeyUsageCertSign,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pki := &testPKI{dir: t.TempDir(), cert: cert, key: key, serial: 1}
+    pki.caFile = filepath.Join(pki.dir, "ca.pem")
+    writePem(t, pki.caFile, "CERTIFICATE", der)
+    return pki
+}
+
+// Issue a certificate for name, valid for 127.0.0.1 when a server certificate.
+func (pki *testPKI) issue(t *testing.T, name string, server bool) (certFile string, keyFile string) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pki.serial++
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(pki.serial),
+        Subject: pkix.Name{CommonName: name},
+        NotBefore: time.Now().Add(-time.Hour),
+        NotAfter: time.Now().Add(time.Hour),
+        KeyUsage: x509.KeyUsageDigitalSignature,
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+    }
+    if server {
+        template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+        template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, pki.cert, &key.PublicKey, pki.key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    certFile = filepath.Join(pki.dir, name + ".pem")
+    keyFile = filepath.Join(pki.dir, name + "-key.pem")
+    writePem(t, certFile, "CERTIFICATE", der)
+    writePem(t, keyFile, "PRIVATE KEY", keyDer)
+    return certFile, keyFile
+}
+
+// An HTTP client trusting the CA, presenting the named client certificate unless name is empty.
+func (pki *testPKI) client(t *testing.T, name string) *http.Client {
+    pool := x509.NewCertPool()
+    pool.AddCert(pki.cert)
+    tlsConfig := &tls.Config{RootCAs: pool}
+    if name != "" {
+        cert, err := tls.LoadX509KeyPair(pki.issue(t, name, false))
+        if err != nil {
+            t.Fatal(err)
+        }
+        tlsConfig.Certificates = []tls.Certificate{cert}
+    }
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.TLSClientConfig = tlsConfig
+    return &http.Client{Transport: transport}
+}
+
+// Start a mutual TLS server, returning a client factory for its RPC endpoint.
+func startTLSTestServer(t *testing.T, config ServerConfig) func(certName string, token bool) *client.Client {
+    pki := newTestPKI(t)
+    config.TLSCertFile, config.TLSKeyFile = pki.issue(t, "server", true)
+    config.ClientCAFile = pki.caFile
+    i, url := runTestServer(t, config, "https", pki.client(t, "platform"), func(config ServerConfig, quit chan os.Signal) error {
+        return RunServer(config, &testService{}, quit)
+    })
+    return func(certName string, token bool) *client.Client {
+        c := client.NewClient(url + "/rpc")
+        c.SetHTTPClient(pki.client(t, certName))
+        if token {
+            minted, err := i.Mint(issuer.TokenClaims{VendorId: testVendorId})
+            if err != nil {
+                t.Fatal(err)
+            }
+            c.SetToken(minted)
+        }
+        return c
+    }
+}
+
+func TestClientCertOrToken(t *testing.T) {
+    newClient := startTLSTestServer(t, ServerConfig{
+        ClientCertMode: auth.ClientCertOrToken,
+        ClientCertSubjects: []string{"platform"},
+        ClientCertScopes: []string{ScopeProvisionWrite},
+        ScopePolicy: DefaultScopePolicy,
+    })
+    ctx := context.Background()
+    create := &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}
+
+    // Allowed certificates authenticate alone, with the configured scopes.
+    if _, err := newClient("platform", false).CreateSubscription(ctx, create); err != nil {
+        t.Fatal(err)
+    }
+    _, err := newClient("platform", false).GetSubscriptionUsage(ctx, &api.GetSubscriptionUsageRequest{AccountId: "acct-1", SubscriptionId: "sub-1"})
+    expectCode(t, err, errors.CodeForbidden)
+
+    // Other certificates must present a token.
+    _, err = newClient("other", false).HealthCheck(ctx, &api.HealthCheckRequest{})
+    expectCode(t, err, errors.CodeUnauthenticated)
+    if _, err := newClient("other", true).HealthCheck(ctx, &api.HealthCheckRequest{}); err != nil {
+        t.Fatal(err)
+    }
+    // As may callers without a certificate.
+    if _, err := newClient("", true).HealthCheck(ctx, &api.HealthCheckRequest{}); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestClientCertAndToken(t *testing.T) {
+    newClient := startTLSTestServer(t, ServerConfig{})
+    ctx := context.Background()
+
+    if _, err := newClient("platform", true).HealthCheck(ctx, &api.HealthCheckRequest{}); err != nil {
+        t.Fatal(err)
+    }
+    _, err := newClient("platform", false).HealthCheck(ctx, &api.HealthCheckRequest{})
+    expectCode(t, err, errors.CodeUnauthenticated)
+
+    // The handshake fails without a certificate.
+    _, err = newClient("", true).HealthCheck(ctx, &api.HealthCheckRequest{})
+    if _, ok := err.(*json2.Error); err == nil || ok {
+        t.Fatalf("expected a TLS failure, got %v", err)
+    }
+}
+
+func TestCertReload(t *testing.T) {
+    pki := newTestPKI(t)
+    certFile, keyFile := pki.issue(t, "server", true)
+    reloader := newCertReloader(certFile, keyFile)
+    if err := reloader.reload(); err != nil {
+        t.Fatal(err)
+    }
+    first, _ := reloader.getCertificate(nil)
+
+    // Renew the certificate in place.
+    renewedCert, renewedKey := pki.issue(t, "renewed", true)
+    for _, file := range [][2]string{{renewedCert, certFile}, {renewedKey, keyFile}} {
+        if err := os.Rename(file[0], file[1]); err != nil {
+            t.Fatal(err)
+        }
+        later := time.Now().Add(time.Minute)
+        if err := os.Chtimes(file[1], later, later); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := reloader.reload(); err != nil {
+        t.Fatal(err)
+    }
+    renewed, _ := reloader.getCertificate(nil)
+    if string(renewed.Certificate[0]) == string(first.Certificate[0]) {
+        t.Fatal("renewed certificate not loaded")
+    }
+
+    // A half written renewal keeps the previous certificate.
+    if err := os.WriteFile(keyFile, []byte("partial"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    later := time.Now().Add(2 * time.Minute)
+    os.Chtimes(keyFile, later, later)
+    if err := reloader.reload(); err == nil {
+        t.Fatal("expected an invalid key to fail the reload")
+    }
+    if current, _ := reloader.getCertificate(nil); current != renewed {
+        t.Fatal("certificate replaced by a failed reload")
+    }
+}
+
+func TestClientCAWithoutTLS(t *testing.T) {
+    config := ServerConfig{Issuer: "http://127.0.0.1:1", VendorId: testVendorId, Address: freeAddress(t), ClientCAFile: "ca.pem"}
+    if err := RunServer(config, &testService{}, make(chan os.Signal, 1)); err == nil {
+        t.Fatal("expected a client CA without TLS to be rejected")
+    }
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+    "context"
+    "net/http"
+    "sort"
+
+    "github.com/gorilla/mux"
+    rpc "github.com/gorilla/rpc/v2"
+    "github.com/gorilla/rpc/v2/json2"
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/auth"
+    "github.com/jupitercloud/subscribed/catalog"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/schema"
+    "github.com/jupitercloud/subscribed/store"
+)
+
+// A vendor hosted by RunMultiVendorServer. Each vendor has its own implementation
+// and state; the remaining ServerConfig settings are shared.
+type Vendor struct {
+    Impl api.SubscriptionServiceInterface
+    // Entitlement store. Vendors must not share a store. Defaults to an
+    // in-memory store, so retries are only idempotent until the process exits.
+    Store store.Store
+    // Optional per-SKU resource configuration schemas.
+    Schemas *schema.Registry
+    // Optional catalog of supported SKUs.
+    Catalog *catalog.Catalog
+}
+
+// The RPC server and lifecycle of one hosted vendor.
+type vendorServer struct {
+    vendorId string
+    vendor Vendor
+    operations *operationWorker
+    rpc *rpc.Server
+}
+
+// Initialize the implementation, store and operation workers, shutting down
+// those already initialized on failure.
+func (v *vendorServer) Initialize(ctx context.Context) error {
+    err := v.vendor.Impl.Initialize(ctx)
+    if (err != nil) {
+        log.Error("Failed to initialize service", "vendor-id", v.vendorId)
+        return err
+    }
+    err = v.vendor.Store.Initialize(ctx)
+    if (err != nil) {
+        log.Error("Failed to initialize store", "vendor-id", v.vendorId)
+        v.vendor.Impl.Shutdown(ctx)
+        return err
+    }
+    err = v.operations.Initialize(ctx)
+    if (err != nil) {
+        log.Error("Failed to initialize operation workers", "vendor-id", v.vendorId)
+        v.vendor.Store.Shutdown(ctx)
+        v.vendor.Impl.Shutdown(ctx)
+        return err
+    }
+    return nil
+}
+
+func (v *vendorServer) Shutdown(ctx context.Context) error {
+    v.operations.Shutdown(ctx)
+    v.vendor.Store.Shutdown(ctx)
+    return v.vendor.Impl.Shutdown(ctx)
+}
+
+func newVendorServer(vendorId string, vendor Vendor, config ServerConfig) *vendorServer {
+    config.VendorId = vendorId
+    if vendor.Store == nil {
+        log.Warn("No entitlement store configured, using an in-memory store; retries are idempotent only until restart",
+            "vendor-id", vendorId)
+        vendor.Store = store.NewMemoryStore()
+    }
+    config.Store = vendor.Store
+    config.Schemas = vendor.Schemas
+    config.Catalog = vendor.Catalog
+    operations := newOperationWorker(config.OperationWorkers, config.OperationMaxAttempts)
+    svc := createSubscriptionService(vendor.Impl, config, operations)
+    // Create a new RPC server
+    s := rpc.NewServer()
+    // Register the type of data requested as JSON
+    s.RegisterCodec(json2.NewCodec(), "application/json")
+    // Register the service by creating a new JSON server
+    s.RegisterService(svc, "")
+    s.RegisterInterceptFunc(rpcHookBefore)
+    s.RegisterAfterFunc(rpcHookAfter)
+    s.RegisterValidateRequestFunc(rpcHookValidate)
+    return &vendorServer{vendorId: vendorId, vendor: vendor, operations: operations, rpc: s}
+}
+
+// Routes RPCs to the vendor named by the token's vendorId claim, or by the
+// /vendors/{vendorId}/rpc path.
+type vendorRouter struct {
+    vendors map[string]*vendorServer
+    // Reports claim errors when no vendor can be chosen.
+    fallback *vendorServer
+}
+
+// Replace the request claims with a copy carrying err.
+func withClaimsError(request *http.Request, claims *auth.Claims, err error) *http.Request {
+    rejected := *claims
+    rejected.Error = err
+    return request.WithContext(context.WithValue(request.Context(), "claims", &rejected))
+}
+
+// Serve /rpc, routed by the vendorId claim.
+func (router *vendorRouter) serveClaimed(response http.ResponseWriter, request *http.Request) {
+    claims := request.Context().Value("claims").(*auth.Claims)
+    if claims.Error != nil {
+        router.fallback.rpc.ServeHTTP(response, request)
+        return
+    }
+    vendor, ok := router.vendors[claims.VendorId]
+    if !ok {
+        router.fallback.rpc.ServeHTTP(response, withClaimsError(request, claims, errors.InvalidVendorIdClaim()))
+        return
+    }
+    vendor.rpc.ServeHTTP(response, request)
+}
+
+// Serve /vendors/{vendorId}/rpc. Tokens must be issued for the vendor in the path.
+func (router *vendorRouter) serveVendorPath(response http.ResponseWriter, request *http.Request) {
+    vendorId := mux.Vars(request)["vendorId"]
+    vendor, ok := router.vendors[vendorId]
+    if !ok {
+        http.NotFound(response, request)
+        return
+    }
+    claims := request.Context().Value("claims").(*auth.Claims)
+    if claims.Error == nil && claims.VendorId != vendorId {
+        if claims.VendorId == "" && claims.Client != nil {
+            // Authenticated by client certificate alone, for any hosted vendor.
+            authorized := *claims
+            authorized.VendorId = vendorId
+            request = request.WithContext(context.WithValue(request.Context(), "claims", &authorized))
+        } else {
+            request = withClaimsError(request, claims, errors.InvalidVendorIdClaim())
+        }
+    }
+    vendor.rpc.ServeHTTP(response, request)
+}
+
+func newVendorRouter(vendors map[string]*vendorServer) *vendorRouter {
+    var vendorIds []string
+    for vendorId := range vendors {
+        vendorIds = append(vendorIds, vendorId)
+    }
+    sort.Strings(vendorIds)
+    return &vendorRouter{vendors: vendors, fallback: vendors[vendorIds[0]]}
+}
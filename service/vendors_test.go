@@ -0,0 +1,64 @@
+package service
+
+import (
+    "context"
+    "net/http"
+    "os"
+    "testing"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/client"
+    "github.com/jupitercloud/subscribed/errors"
+    "github.com/jupitercloud/subscribed/issuer"
+)
+
+func TestVendorRouting(t *testing.T) {
+    impls := map[string]*testService{"vendor-1": {}, "vendor-2": {}}
+    vendors := map[string]Vendor{}
+    for vendorId, impl := range impls {
+        vendors[vendorId] = Vendor{Impl: impl}
+    }
+    i, url := runTestServer(t, ServerConfig{}, "http", http.DefaultClient, func(config ServerConfig, quit chan os.Signal) error {
+        return RunMultiVendorServer(config, vendors, quit)
+    })
+    ctx := context.Background()
+    newClient := func(path string, vendorId string) *client.Client {
+        token, err := i.Mint(issuer.TokenClaims{VendorId: vendorId})
+        if err != nil {
+            t.Fatal(err)
+        }
+        c := client.NewClient(url + path)
+        c.SetToken(token)
+        return c
+    }
+    create := &api.CreateSubscriptionRequest{AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1}
+
+    // Routed by the token's vendor, with separate state per vendor.
+    for _, vendorId := range []string{"vendor-1", "vendor-2"} {
+        reply, err := newClient("/rpc", vendorId).CreateSubscription(ctx, create)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if reply.Url != "https://example.com/subscriptions/sub-1/1" {
+            t.Errorf("%s: unexpected reply %q", vendorId, reply.Url)
+        }
+    }
+    for vendorId, impl := range impls {
+        if calls := impl.subscriptions.Load(); calls != 1 {
+            t.Errorf("%s called %d times, expected once", vendorId, calls)
+        }
+    }
+
+    _, err := newClient("/rpc", "vendor-3").HealthCheck(ctx, &api.HealthCheckRequest{})
+    expectCode(t, err, errors.CodeInvalidVendorIdClaim)
+
+    // Per-vendor paths only accept tokens for that vendor.
+    if _, err := newClient("/vendors/vendor-2/rpc", "vendor-2").HealthCheck(ctx, &api.HealthCheckRequest{}); err != nil {
+        t.Fatal(err)
+    }
+    _, err = newClient("/vendors/vendor-2/rpc", "vendor-1").HealthCheck(ctx, &api.HealthCheckRequest{})
+    expectCode(t, err, errors.CodeInvalidVendorIdClaim)
+    if _, err := newClient("/vendors/vendor-3/rpc", "vendor-3").HealthCheck(ctx, &api.HealthCheckRequest{}); err == nil {
+        t.Fatal("expected an unknown vendor path to fail")
+    }
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+    "context"
+    "encoding/json"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+var (
+    accountsBucket = []byte("accounts")
+    subscriptionsBucket = []byte("subscriptions")
+    resourcesBucket = []byte("resources")
+)
+
+// Persistent store backed by an embedded bbolt database file.
+type boltStore struct {
+    path string
+    db *bolt.DB
+}
+
+func (s *boltStore) Initialize(ctx context.Context) error {
+    log.Info("Initializing bolt store", "path", s.path)
+    db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+    if err != nil {
+        return err
+    }
+
+    err = db.Update(func(tx *bolt.Tx) error {
+        for _, bucket := range [][]byte{accountsBucket, subscriptionsBucket, resourcesBucket} {
+            if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        db.Close()
+        return err
+    }
+
+    s.db = db
+    return nil
+}
+
+func (s *boltStore) Shutdown(ctx context.Context) error {
+    log.Debug("Shutting down bolt store")
+    if s.db == nil {
+        return nil
+    }
+    return s.db.Close()
+}
+
+func (s *boltStore) put(bucket []byte, key string, value interface{}) error {
+    data, err := json.Marshal(value)
+    if err != nil {
+        return err
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(bucket).Put([]byte(key), data)
+    })
+}
+
+func (s *boltStore) get(bucket []byte, key string, value interface{}) error {
+    return s.db.View(func(tx *bolt.Tx) error {
+        data := tx.Bucket(bucket).Get([]byte(key))
+        if data == nil {
+            return ErrNotFound
+        }
+        return json.Unmarshal(data, value)
+    })
+}
+
+// Call fn with each raw record in the bucket.
+func (s *boltStore) scan(bucket []byte, fn func(data []byte) error) error {
+    return s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(bucket).ForEach(func(key []byte, data []byte) error {
+            return fn(data)
+        })
+    })
+}
+
+func (s *boltStore) PutAccount(ctx context.Context, account *Account) error {
+    return s.put(accountsBucket, account.AccountId, account)
+}
+
+func (s *boltStore) GetAccount(ctx context.Context, accountId string) (*Account, error) {
+    var account Account
+    if err := s.get(accountsBucket, accountId, &account); err != nil {
+        return nil, err
+    }
+    return &account, nil
+}
+
+func (s *boltStore) PutSubscription(ctx context.Context, subscription *Subscription) error {
+    return s.put(subscriptionsBucket, subscription.SubscriptionId, subscription)
+}
+
+func (s *boltStore) GetSubscription(ctx context.Context, subscriptionId string) (*Subscription, error) {
+    var subscription Subscription
+    if err := s.get(subscriptionsBucket, subscriptionId, &subscription); err != nil {
+        return nil, err
+    }
+    return &subscription, nil
+}
+
+func (s *boltStore) ListSubscriptions(ctx context.Context, filter SubscriptionFilter) ([]*Subscription, error) {
+    var result []*Subscription
+    err := s.scan(subscriptionsBucket, func(data []byte) error {
+        var subscription Subscription
+        if err := json.Unmarshal(data, &subscription); err != nil {
+            return err
+        }
+        if filter.matches(&subscription) {
+            result = append(result, &subscription)
+        }
+        return nil
+    })
+    return result, err
+}
+
+func (s *boltStore) PutResource(ctx context.Context, resource *Resource) error {
+    return s.put(resourcesBucket, resource.ResourceId, resource)
+}
+
+func (s *boltStore) GetResource(ctx context.Context, resourceId string) (*Resource, error) {
+    var resource Resource
+    if err := s.get(resourcesBucket, resourceId, &resource); err != nil {
+        return nil, err
+    }
+    return &resource, nil
+}
+
+func (s *boltStore) ListResources(ctx context.Context, filter ResourceFilter) ([]*Resource, error) {
+    var result []*Resource
+    err := s.scan(resourcesBucket, func(data []byte) error {
+        var resource Resource
+        if err := json.Unmarshal(data, &resource); err != nil {
+            return err
+        }
+        if filter.matches(&resource) {
+            result = append(result, &resource)
+        }
+        return nil
+    })
+    return result, err
+}
+
+// Create a store persisted to the bbolt database file at path.
+// The file is created on Initialize if it does not exist.
+func NewBoltStore(path string) Store {
+    return &boltStore{path: path}
+}
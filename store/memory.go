@@ -0,0 +1,134 @@
+package store
+
+import (
+    "context"
+    "encoding/json"
+    "sync"
+)
+
+// In-memory store. Records are lost when the process exits. Like the bolt
+// store, records are held JSON encoded, so callers never share maps, slices or
+// configuration with the stored state.
+type memoryStore struct {
+    mutex sync.RWMutex
+    accounts map[string][]byte
+    subscriptions map[string][]byte
+    resources map[string][]byte
+}
+
+func (s *memoryStore) Initialize(ctx context.Context) error {
+    log.Info("Initializing in-memory store")
+    return nil
+}
+
+func (s *memoryStore) Shutdown(ctx context.Context) error {
+    log.Debug("Shutting down in-memory store")
+    return nil
+}
+
+func (s *memoryStore) put(records map[string][]byte, key string, value interface{}) error {
+    data, err := json.Marshal(value)
+    if err != nil {
+        return err
+    }
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    records[key] = data
+    return nil
+}
+
+func (s *memoryStore) get(records map[string][]byte, key string, value interface{}) error {
+    s.mutex.RLock()
+    data, ok := records[key]
+    s.mutex.RUnlock()
+    if !ok {
+        return ErrNotFound
+    }
+    return json.Unmarshal(data, value)
+}
+
+// Call fn with each encoded record.
+func (s *memoryStore) scan(records map[string][]byte, fn func(data []byte) error) error {
+    s.mutex.RLock()
+    defer s.mutex.RUnlock()
+    for _, data := range records {
+        if err := fn(data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *memoryStore) PutAccount(ctx context.Context, account *Account) error {
+    return s.put(s.accounts, account.AccountId, account)
+}
+
+func (s *memoryStore) GetAccount(ctx context.Context, accountId string) (*Account, error) {
+    var account Account
+    if err := s.get(s.accounts, accountId, &account); err != nil {
+        return nil, err
+    }
+    return &account, nil
+}
+
+func (s *memoryStore) PutSubscription(ctx context.Context, subscription *Subscription) error {
+    return s.put(s.subscriptions, subscription.SubscriptionId, subscription)
+}
+
+func (s *memoryStore) GetSubscription(ctx context.Context, subscriptionId string) (*Subscription, error) {
+    var subscription Subscription
+    if err := s.get(s.subscriptions, subscriptionId, &subscription); err != nil {
+        return nil, err
+    }
+    return &subscription, nil
+}
+
+func (s *memoryStore) ListSubscriptions(ctx context.Context, filter SubscriptionFilter) ([]*Subscription, error) {
+    var result []*Subscription
+    err := s.scan(s.subscriptions, func(data []byte) error {
+        var subscription Subscription
+        if err := json.Unmarshal(data, &subscription); err != nil {
+            return err
+        }
+        if filter.matches(&subscription) {
+            result = append(result, &subscription)
+        }
+        return nil
+    })
+    return result, err
+}
+
+func (s *memoryStore) PutResource(ctx context.Context, resource *Resource) error {
+    return s.put(s.resources, resource.ResourceId, resource)
+}
+
+func (s *memoryStore) GetResource(ctx context.Context, resourceId string) (*Resource, error) {
+    var resource Resource
+    if err := s.get(s.resources, resourceId, &resource); err != nil {
+        return nil, err
+    }
+    return &resource, nil
+}
+
+func (s *memoryStore) ListResources(ctx context.Context, filter ResourceFilter) ([]*Resource, error) {
+    var result []*Resource
+    err := s.scan(s.resources, func(data []byte) error {
+        var resource Resource
+        if err := json.Unmarshal(data, &resource); err != nil {
+            return err
+        }
+        if filter.matches(&resource) {
+            result = append(result, &resource)
+        }
+        return nil
+    })
+    return result, err
+}
+
+func NewMemoryStore() Store {
+    return &memoryStore{
+        accounts: make(map[string][]byte),
+        subscriptions: make(map[string][]byte),
+        resources: make(map[string][]byte),
+    }
+}
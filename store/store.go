@@ -0,0 +1,149 @@
+// Package store keeps a local record of the accounts, subscriptions and resources
+// provisioned through the SubscriptionService.
+package store
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "time"
+
+    "github.com/jupitercloud/subscribed/api"
+    "github.com/jupitercloud/subscribed/logger"
+)
+
+var log = logger.Named("store");
+
+// Returned by Get* queries when no record exists.
+var ErrNotFound = errors.New("record not found")
+
+type Status string
+
+const (
+    StatusActive Status = "ACTIVE"
+    StatusTerminated Status = "TERMINATED"
+    // Access locked out, e.g. for non-payment. Data is preserved.
+    StatusSuspended Status = "SUSPENDED"
+    // Asynchronous creation in progress.
+    StatusProvisioning Status = "PROVISIONING"
+    // Asynchronous termination in progress.
+    StatusTerminating Status = "TERMINATING"
+    // Asynchronous creation failed.
+    StatusFailed Status = "FAILED"
+)
+
+type Account struct {
+    // Account ID
+    AccountId string `json:"accountId"`
+    // Account name
+    Name string `json:"name"`
+    // Address info
+    Addresses []api.Address `json:"addresses"`
+    // Vendor-defined data associated with this account.
+    AccountData api.Metadata `json:"accountData"`
+    // Lifecycle status
+    Status Status `json:"status"`
+    CreatedAt time.Time `json:"createdAt"`
+    UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Subscription struct {
+    // Account ID owning the subscription.
+    AccountId string `json:"accountId"`
+    // Subscription ID assigned by Jupiter Cloud.
+    SubscriptionId string `json:"subscriptionId"`
+    // SKU subscribed.
+    Sku int64 `json:"sku"`
+    // Vendor-defined data for the subscription.
+    SubscriptionData api.Metadata `json:"subscriptionData"`
+    // URL to access this subscription.
+    Url string `json:"url"`
+    // Human readable instructions to access this subscription.
+    Instructions api.RichText `json:"instructions"`
+    // Reason given for the current suspension, when SUSPENDED.
+    SuspendReason string `json:"suspendReason,omitempty"`
+    // Lifecycle status
+    Status Status `json:"status"`
+    CreatedAt time.Time `json:"createdAt"`
+    UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Resource struct {
+    // Account ID owning the resource.
+    AccountId string `json:"accountId"`
+    // Subscription ID associated with the resource.
+    SubscriptionId string `json:"subscriptionId"`
+    // Resource ID assigned by Jupiter Cloud.
+    ResourceId string `json:"resourceId"`
+    // SKU for the subscription.
+    Sku int64 `json:"sku"`
+    // Resource name assigned by the user.
+    ResourceName string `json:"resourceName"`
+    // Vendor-defined configuration for this SKU.
+    Configuration json.RawMessage `json:"configuration"`
+    // Vendor-defined data associated with this resource.
+    ResourceData api.Metadata `json:"resourceData"`
+    // URL to access this resource
+    Url string `json:"url"`
+    // Human readable instructions to access this resource.
+    Instructions api.RichText `json:"instructions"`
+    // Most recent asynchronous operation on this resource, if any.
+    OperationId string `json:"operationId,omitempty"`
+    // Lifecycle status
+    Status Status `json:"status"`
+    CreatedAt time.Time `json:"createdAt"`
+    UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Query filter for subscriptions. Zero-valued fields match any record.
+type SubscriptionFilter struct {
+    AccountId string
+    Sku int64
+    Status Status
+}
+
+// Query filter for resources. Zero-valued fields match any record.
+type ResourceFilter struct {
+    AccountId string
+    SubscriptionId string
+    Sku int64
+    Status Status
+}
+
+type Store interface {
+    api.Initializable
+
+    // Insert or replace an account record.
+    PutAccount(ctx context.Context, account *Account) error
+    // Fetch an account by ID, or ErrNotFound.
+    GetAccount(ctx context.Context, accountId string) (*Account, error)
+
+    // Insert or replace a subscription record.
+    PutSubscription(ctx context.Context, subscription *Subscription) error
+    // Fetch a subscription by ID, or ErrNotFound.
+    GetSubscription(ctx context.Context, subscriptionId string) (*Subscription, error)
+    // List subscriptions matching the filter.
+    ListSubscriptions(ctx context.Context, filter SubscriptionFilter) ([]*Subscription, error)
+
+    // Insert or replace a resource record.
+    PutResource(ctx context.Context, resource *Resource) error
+    // Fetch a resource by ID, or ErrNotFound.
+    GetResource(ctx context.Context, resourceId string) (*Resource, error)
+    // List resources matching the filter.
+    ListResources(ctx context.Context, filter ResourceFilter) ([]*Resource, error)
+}
+
+func (filter *SubscriptionFilter) matches(subscription *Subscription) bool {
+    if filter.AccountId != "" && filter.AccountId != subscription.AccountId { return false }
+    if filter.Sku != 0 && filter.Sku != subscription.Sku { return false }
+    if filter.Status != "" && filter.Status != subscription.Status { return false }
+    return true
+}
+
+func (filter *ResourceFilter) matches(resource *Resource) bool {
+    if filter.AccountId != "" && filter.AccountId != resource.AccountId { return false }
+    if filter.SubscriptionId != "" && filter.SubscriptionId != resource.SubscriptionId { return false }
+    if filter.Sku != 0 && filter.Sku != resource.Sku { return false }
+    if filter.Status != "" && filter.Status != resource.Status { return false }
+    return true
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+    "context"
+    "encoding/json"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/jupitercloud/subscribed/api"
+)
+
+// Run fn against each store implementation.
+func forEachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+    stores := map[string]func(t *testing.T) Store{
+        "memory": func(t *testing.T) Store { return NewMemoryStore() },
+        "bolt": func(t *testing.T) Store { return NewBoltStore(filepath.Join(t.TempDir(), "store.db")) },
+    }
+    for name, create := range stores {
+        t.Run(name, func(t *testing.T) {
+            s := create(t)
+            if err := s.Initialize(context.Background()); err != nil {
+                t.Fatal(err)
+            }
+            defer s.Shutdown(context.Background())
+            fn(t, s)
+        })
+    }
+}
+
+func TestAccountRoundTrip(t *testing.T) {
+    forEachStore(t, func(t *testing.T, s Store) {
+        ctx := context.Background()
+        if _, err := s.GetAccount(ctx, "acct-1"); err != ErrNotFound {
+            t.Fatalf("expected ErrNotFound, got %v", err)
+        }
+        account := &Account{
+            AccountId: "acct-1",
+            Name: "Acme",
+            Addresses: []api.Address{{AddressId: "addr-1", City: "Springfield"}},
+            AccountData: api.Metadata{"plan": "gold"},
+            Status: StatusActive,
+            CreatedAt: time.Now().UTC().Truncate(time.Second),
+        }
+        if err := s.PutAccount(ctx, account); err != nil {
+            t.Fatal(err)
+        }
+        // Changes to the caller's copy must not reach the store.
+        account.AccountData["plan"] = "silver"
+        account.Addresses[0].City = "Shelbyville"
+
+        stored, err := s.GetAccount(ctx, "acct-1")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if stored.Name != "Acme" || stored.AccountData["plan"] != "gold" || stored.Addresses[0].City != "Springfield" {
+            t.Fatalf("unexpected record: %+v", stored)
+        }
+        if !stored.CreatedAt.Equal(account.CreatedAt) {
+            t.Errorf("created at %v, expected %v", stored.CreatedAt, account.CreatedAt)
+        }
+
+        // Nor changes to a fetched copy.
+        stored.AccountData["plan"] = "bronze"
+        again, _ := s.GetAccount(ctx, "acct-1")
+        if again.AccountData["plan"] != "gold" {
+            t.Fatalf("fetched record shares state with the store")
+        }
+    })
+}
+
+func TestResourceRoundTrip(t *testing.T) {
+    forEachStore(t, func(t *testing.T, s Store) {
+        ctx := context.Background()
+        configuration := []byte(`{"size":"large"}`)
+        resource := &Resource{
+            AccountId: "acct-1",
+            SubscriptionId: "sub-1",
+            ResourceId: "res-1",
+            Sku: 7,
+            Configuration: json.RawMessage(configuration),
+            OperationId: "op-1",
+            Status: StatusProvisioning,
+        }
+        if err := s.PutResource(ctx, resource); err != nil {
+            t.Fatal(err)
+        }
+        configuration[2] = 'X'
+
+        stored, err := s.GetResource(ctx, "res-1")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(stored.Configuration) != `{"size":"large"}` || stored.OperationId != "op-1" || stored.Status != StatusProvisioning {
+            t.Fatalf("unexpected record: %+v", stored)
+        }
+    })
+}
+
+func TestListFilters(t *testing.T) {
+    forEachStore(t, func(t *testing.T, s Store) {
+        ctx := context.Background()
+        subscriptions := []*Subscription{
+            {AccountId: "acct-1", SubscriptionId: "sub-1", Sku: 1, Status: StatusActive},
+            {AccountId: "acct-1", SubscriptionId: "sub-2", Sku: 2, Status: StatusTerminated},
+            {AccountId: "acct-2", SubscriptionId: "sub-3", Sku: 1, Status: StatusActive},
+        }
+        for _, subscription := range subscriptions {
+            if err := s.PutSubscription(ctx, subscription); err != nil {
+                t.Fatal(err)
+            }
+        }
+
+        tests := []struct {
+            filter SubscriptionFilter
+            count int
+        }{
+            {SubscriptionFilter{}, 3},
+            {SubscriptionFilter{AccountId: "acct-1"}, 2},
+            {SubscriptionFilter{Sku: 1}, 2},
+            {SubscriptionFilter{AccountId: "acct-1", Status: StatusActive}, 1},
+            {SubscriptionFilter{AccountId: "acct-3"}, 0},
+        }
+        for _, test := range tests {
+            found, err := s.ListSubscriptions(ctx, test.filter)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(found) != test.count {
+                t.Errorf("filter %+v matched %d subscriptions, expected %d", test.filter, len(found), test.count)
+            }
+        }
+    })
+}
@@ -3,16 +3,19 @@ package telemetry
 import (
     "context"
     "errors"
+    "net/http"
 
     "go.opentelemetry.io/otel"
     "go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
     "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+    "go.opentelemetry.io/otel/exporters/prometheus"
     "go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
     "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
     "go.opentelemetry.io/otel/propagation"
     "go.opentelemetry.io/otel/sdk/metric"
     "go.opentelemetry.io/otel/sdk/trace"
     "github.com/jupitercloud/subscribed/logger"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var log = logger.Named("telemetry");
@@ -23,16 +26,27 @@ const (
 	ExportModeNone = iota
     ExportModeConsole
     ExportModeGrpc
+    ExportModePrometheus
 )
 
 func ExportModeFromString(mode string) ExportMode {
     if mode == "none" { return ExportModeNone }
     if mode == "console" { return ExportModeConsole }
     if mode == "grpc" { return ExportModeGrpc }
+    if mode == "prometheus" { return ExportModePrometheus }
     log.Warn("Invalid telemetry export mode", "mode", mode)
     return ExportModeNone
 }
 
+// Serves the Prometheus exposition format, once initialized with ExportModePrometheus.
+var metricsHandler http.Handler
+
+// The handler serving metrics for a Prometheus scrape, e.g. at /metrics. Nil
+// unless telemetry was initialized with ExportModePrometheus.
+func MetricsHandler() http.Handler {
+    return metricsHandler
+}
+
 // Initialize bootstraps the OpenTelemetry pipeline and returns a shutdown callback.
 func Initialize(ctx context.Context, exportMode ExportMode) (shutdown func(context.Context) error, err error) {
     if exportMode == ExportModeNone {
@@ -64,15 +78,17 @@ func Initialize(ctx context.Context, exportMode ExportMode) (shutdown func(conte
     prop := newPropagator()
     otel.SetTextMapPropagator(prop)
 
-    // Set up trace provider.
-    tracerProvider, err := newTraceProvider(exportMode)
-    if err != nil {
-        handleErr(err)
-        return nil, err
-    }
+    // Set up trace provider. Prometheus exports metrics only.
+    if exportMode != ExportModePrometheus {
+        tracerProvider, err := newTraceProvider(exportMode)
+        if err != nil {
+            handleErr(err)
+            return nil, err
+        }
 
-    shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
-    otel.SetTracerProvider(tracerProvider)
+        shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
+        otel.SetTracerProvider(tracerProvider)
+    }
 
     // Set up meter provider.
     meterProvider, err := newMeterProvider(exportMode)
@@ -114,6 +130,16 @@ func newTraceProvider(exportMode ExportMode) (*trace.TracerProvider, error) {
 }
 
 func newMeterProvider(exportMode ExportMode) (*metric.MeterProvider, error) {
+    if exportMode == ExportModePrometheus {
+        // The Prometheus exporter is a reader, collecting on each scrape.
+        reader, err := prometheus.New()
+        if err != nil {
+            return nil, err
+        }
+        metricsHandler = promhttp.Handler()
+        return metric.NewMeterProvider(metric.WithReader(reader)), nil
+    }
+
     var err error = nil
     var exporter metric.Exporter = nil
     switch (exportMode) {
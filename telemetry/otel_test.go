@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+    "context"
+    "io"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "go.opentelemetry.io/otel"
+)
+
+func TestPrometheusMode(t *testing.T) {
+    if MetricsHandler() != nil {
+        t.Fatal("metrics handler set before initialization")
+    }
+    shutdown, err := Initialize(context.Background(), ExportModeFromString("prometheus"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer shutdown(context.Background())
+    handler := MetricsHandler()
+    if handler == nil {
+        t.Fatal("no metrics handler in prometheus mode")
+    }
+
+    counter, err := otel.Meter("test").Int64Counter("test.requests")
+    if err != nil {
+        t.Fatal(err)
+    }
+    counter.Add(context.Background(), 3)
+
+    response := httptest.NewRecorder()
+    handler.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+    body, _ := io.ReadAll(response.Body)
+    for _, expected := range []string{"test_requests_total", "go_goroutines"} {
+        if !strings.Contains(string(body), expected) {
+            t.Errorf("scrape is missing %s:\n%s", expected, body)
+        }
+    }
+    for _, line := range strings.Split(string(body), "\n") {
+        if strings.HasPrefix(line, "test_requests_total") && !strings.HasSuffix(line, " 3") {
+            t.Errorf("scraped %q, expected a count of 3", line)
+        }
+    }
+}
+
+func TestExportModeFromString(t *testing.T) {
+    for name, mode := range map[string]ExportMode{
+        "none": ExportModeNone,
+        "console": ExportModeConsole,
+        "grpc": ExportModeGrpc,
+        "prometheus": ExportModePrometheus,
+        "statsd": ExportModeNone,
+    } {
+        if got := ExportModeFromString(name); got != mode {
+            t.Errorf("%s parsed as %d, expected %d", name, got, mode)
+        }
+    }
+}